@@ -21,6 +21,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"strconv"
 	"time"
@@ -29,10 +30,12 @@ import (
 	"go.uber.org/zap/zapcore"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	ctrlzap "sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
@@ -53,18 +56,26 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var jwksAddr string
+	var issuerCheckInterval time.Duration
+	var readyzRequireHealthyIssuer bool
 
 	var maxRetryDuration time.Duration
 	var clusterResourceNamespace string
+	var leaderElectionNamespace string
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.StringVar(&jwksAddr, "jwks-bind-address", "", "The address the JWKS of issuers in ProviderJWT attestation mode is served on at /jwks.json. Disabled when empty.")
+	flag.DurationVar(&issuerCheckInterval, "issuer-check-interval", 5*time.Minute, "How often every issuer is checked against ZTS. Disabled when 0.")
+	flag.BoolVar(&readyzRequireHealthyIssuer, "readyz-require-healthy-issuer", false, "Fail the readiness check of the leader while none of the issuers passed its last check. A controller without issuers is ready.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", true,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
 
 	flag.DurationVar(&maxRetryDuration, "max-retry-duration", 2*time.Minute, "The max amount of time after certificate request creation that we will retry when an error occurs.")
 	flag.StringVar(&clusterResourceNamespace, "cluster-resource-namespace", "", "The namespace for secrets in which cluster-scoped resources are found.")
+	flag.StringVar(&leaderElectionNamespace, "leader-election-namespace", "", "The namespace of the leader election Lease. Defaults to the namespace the controller runs in, or to --cluster-resource-namespace when running out-of-cluster.")
 
 	flag.Parse()
 
@@ -112,6 +123,14 @@ func main() {
 
 	setupLog := ctrl.Log.WithName("setup")
 
+	if leaderElectionNamespace == "" {
+		// in-cluster the Lease stays in the release namespace, where the
+		// leader election Role grants access to it
+		if _, err := os.Stat(inClusterNamespacePath); err != nil {
+			leaderElectionNamespace = clusterResourceNamespace
+		}
+	}
+
 	err := getInClusterNamespace(&clusterResourceNamespace)
 	if err != nil {
 		if errors.Is(err, errNotInCluster) {
@@ -123,6 +142,7 @@ func main() {
 	}
 
 	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(athenzissuerapi.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 
@@ -137,6 +157,10 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "f8s4b32e.cert-manager.athenz.io",
+		// Set explicitly so the controller can run out-of-cluster with a
+		// kubeconfig, where the namespace cannot be discovered. Left empty
+		// controller-runtime uses the in-cluster namespace.
+		LeaderElectionNamespace: leaderElectionNamespace,
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -159,10 +183,30 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&controller.Signer{}).SetupWithManager(ctx, mgr); err != nil {
+	signer := &controller.Signer{
+		ClusterResourceNamespace: clusterResourceNamespace,
+		CheckInterval:            issuerCheckInterval,
+	}
+	if err = signer.SetupWithManager(ctx, mgr); err != nil {
 		setupLog.Error(err, "unable to create controller")
 		os.Exit(1)
 	}
+
+	if jwksAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/jwks.json", signer.JWKSHandler())
+		if err := mgr.Add(&manager.Server{
+			Name: "jwks",
+			Server: &http.Server{
+				Addr:              jwksAddr,
+				Handler:           mux,
+				ReadHeaderTimeout: 10 * time.Second,
+			},
+		}); err != nil {
+			setupLog.Error(err, "unable to set up JWKS server")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -173,6 +217,10 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if err := mgr.AddReadyzCheck("issuers", signer.ReadyzCheck(readyzRequireHealthyIssuer)); err != nil {
+		setupLog.Error(err, "unable to set up issuer ready check")
+		os.Exit(1)
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctx); err != nil {
@@ -0,0 +1,80 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	issuerutil "github.com/AthenZ/athenz-issuer/internal"
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+)
+
+// addAttestationContext fills in the cluster and workload details of the
+// request. The pod is looked up to learn its node and to make sure it is the
+// pod named by the request and runs as the requested identity, pod details
+// that cannot be confirmed are left out.
+func addAttestationContext(ctx context.Context, reader client.Reader, data *K8SAttestationData, config *athenzissuerapi.AttestationContext, cr signer.CertificateRequestObject, identity *issuerutil.SpiffeIdentity, workload issuerutil.WorkloadAnnotations) error {
+	data.ClusterName = config.ClusterName
+	data.RequestUID = string(cr.GetUID())
+
+	if workload.PodName != "" {
+		pod := &corev1.Pod{}
+		err := reader.Get(ctx, types.NamespacedName{Namespace: identity.Namespace, Name: workload.PodName}, pod)
+		switch {
+		case apierrors.IsNotFound(err):
+			// the pod may be gone already, attest the ServiceAccount only
+		case err != nil:
+			return fmt.Errorf("failed to get pod %s in namespace %s: %w", workload.PodName, identity.Namespace, err)
+		case workload.PodUID != "" && workload.PodUID != string(pod.UID):
+			return signer.PermanentError{Err: fmt.Errorf("pod %s in namespace %s has uid %s, not %s", workload.PodName, identity.Namespace, pod.UID, workload.PodUID)}
+		case pod.Namespace != identity.Namespace || !podRunsAs(pod, identity):
+			return signer.PermanentError{Err: fmt.Errorf("pod %s in namespace %s runs as service account %s, not as %s", workload.PodName, pod.Namespace, pod.Spec.ServiceAccountName, identity.ServiceAccount)}
+		default:
+			data.PodName = pod.Name
+			data.PodUID = string(pod.UID)
+			data.NodeName = pod.Spec.NodeName
+		}
+	}
+
+	data.InstanceID = attestationInstanceID(config.ClusterName, identity, data.PodUID)
+	return nil
+}
+
+// podRunsAs reports whether the pod runs as the ServiceAccount of identity,
+// which may also be named after the service alone.
+func podRunsAs(pod *corev1.Pod, identity *issuerutil.SpiffeIdentity) bool {
+	_, service := issuerutil.ExtractDomainServiceFromServiceAccount(identity.ServiceAccount)
+	return pod.Spec.ServiceAccountName == identity.ServiceAccount || pod.Spec.ServiceAccountName == service
+}
+
+// attestationInstanceID derives an instance ID that is the same for every
+// request of a pod, or of a ServiceAccount when the pod is not known.
+func attestationInstanceID(clusterName string, identity *issuerutil.SpiffeIdentity, podUID string) string {
+	name := fmt.Sprintf("k8s://%s/ns/%s/sa/%s", clusterName, identity.Namespace, identity.ServiceAccount)
+	if podUID != "" {
+		name = fmt.Sprintf("k8s://%s/pod/%s", clusterName, podUID)
+	}
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(name)).String()
+}
@@ -0,0 +1,139 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	issuerutil "github.com/AthenZ/athenz-issuer/internal"
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+)
+
+func TestAttestationInstanceID(t *testing.T) {
+	identity := &issuerutil.SpiffeIdentity{Namespace: "sandbox", ServiceAccount: "athenz.prod.api"}
+	other := &issuerutil.SpiffeIdentity{Namespace: "sandbox", ServiceAccount: "athenz.prod.web"}
+
+	podID := attestationInstanceID("prod-east", identity, "6a0b4d1e-pod")
+	if podID != attestationInstanceID("prod-east", identity, "6a0b4d1e-pod") {
+		t.Errorf("Expected the instance id of a pod to be stable")
+	}
+	if podID == attestationInstanceID("prod-west", identity, "6a0b4d1e-pod") {
+		t.Errorf("Expected the instance id to differ between clusters")
+	}
+
+	saID := attestationInstanceID("prod-east", identity, "")
+	if saID == podID {
+		t.Errorf("Expected the service account instance id to differ from the pod instance id")
+	}
+	if saID == attestationInstanceID("prod-east", other, "") {
+		t.Errorf("Expected the instance id to differ between service accounts")
+	}
+}
+
+func TestAddAttestationContext(t *testing.T) {
+	newPod := func(name, uid, serviceAccount string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "sandbox", Name: name, UID: types.UID(uid)},
+			Spec:       corev1.PodSpec{ServiceAccountName: serviceAccount, NodeName: "node-1"},
+		}
+	}
+	reader := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		newPod("api-0", "uid-api", "athenz.prod.api"),
+		newPod("web-0", "uid-web", "web"),
+		newPod("db-0", "uid-db", "athenz.prod.db"),
+	).Build()
+	identity := &issuerutil.SpiffeIdentity{Namespace: "sandbox", ServiceAccount: "athenz.prod.api"}
+	webIdentity := &issuerutil.SpiffeIdentity{Namespace: "sandbox", ServiceAccount: "athenz.prod.web"}
+
+	testCases := []struct {
+		name         string
+		identity     *issuerutil.SpiffeIdentity
+		workload     issuerutil.WorkloadAnnotations
+		expectedPod  string
+		expectedNode string
+		expectError  bool
+	}{
+		{
+			name:         "pod of the identity",
+			identity:     identity,
+			workload:     issuerutil.WorkloadAnnotations{PodName: "api-0", PodUID: "uid-api"},
+			expectedPod:  "api-0",
+			expectedNode: "node-1",
+		},
+		{
+			name:         "service account named after the service",
+			identity:     webIdentity,
+			workload:     issuerutil.WorkloadAnnotations{PodName: "web-0"},
+			expectedPod:  "web-0",
+			expectedNode: "node-1",
+		},
+		{
+			name:        "pod of another service account",
+			identity:    identity,
+			workload:    issuerutil.WorkloadAnnotations{PodName: "db-0", PodUID: "uid-db"},
+			expectError: true,
+		},
+		{
+			name:        "uid of another pod",
+			identity:    identity,
+			workload:    issuerutil.WorkloadAnnotations{PodName: "api-0", PodUID: "uid-db"},
+			expectError: true,
+		},
+		{
+			name:     "pod that is gone",
+			identity: identity,
+			workload: issuerutil.WorkloadAnnotations{PodName: "api-1", PodUID: "uid-gone"},
+		},
+		{
+			name:     "uid without a pod name",
+			identity: identity,
+			workload: issuerutil.WorkloadAnnotations{PodUID: "uid-db"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := &K8SAttestationData{}
+			cr := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Namespace: "sandbox", Name: "cr", UID: "uid-cr"}}
+			err := addAttestationContext(context.Background(), reader, data, &athenzissuerapi.AttestationContext{ClusterName: "prod-east"}, signer.CertificateRequestObjectFromCertificateRequest(cr), tc.identity, tc.workload)
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("Expected an error for pod %s", tc.workload.PodName)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if data.PodName != tc.expectedPod || data.NodeName != tc.expectedNode {
+				t.Errorf("Expected pod %q on node %q, but got pod %q on node %q", tc.expectedPod, tc.expectedNode, data.PodName, data.NodeName)
+			}
+			if tc.expectedPod == "" && data.PodUID != "" {
+				t.Errorf("Expected the unconfirmed pod uid %s to be left out", data.PodUID)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+	"github.com/cert-manager/issuer-lib/api/v1alpha1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+)
+
+// checkIssuerMayAttestNamespace confines a namespaced issuer to ServiceAccounts
+// in its own namespace and a cluster issuer to the namespaces it is scoped to.
+func checkIssuerMayAttestNamespace(ctx context.Context, reader client.Reader, issuerObject v1alpha1.Issuer, namespace string) error {
+	switch t := issuerObject.(type) {
+	case *athenzissuerapi.AthenzIssuer:
+		if namespace != t.Namespace {
+			return signer.PermanentError{Err: fmt.Errorf("issuer %s/%s may only attest service accounts in namespace %s, not %s", t.Namespace, t.Name, t.Namespace, namespace)}
+		}
+	case *athenzissuerapi.AthenzClusterIssuer:
+		if len(t.Spec.AllowedNamespaces) > 0 && !slices.Contains(t.Spec.AllowedNamespaces, namespace) {
+			return signer.PermanentError{Err: fmt.Errorf("cluster issuer %s is not allowed to attest service accounts in namespace %s", t.Name, namespace)}
+		}
+		if t.Spec.NamespaceSelector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(t.Spec.NamespaceSelector)
+			if err != nil {
+				return signer.IssuerError{Err: fmt.Errorf("invalid namespace selector: %w", err)}
+			}
+
+			ns := &corev1.Namespace{}
+			if err := reader.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+				return fmt.Errorf("failed to get namespace %s: %w", namespace, err)
+			}
+			if !selector.Matches(labels.Set(ns.Labels)) {
+				return signer.PermanentError{Err: fmt.Errorf("cluster issuer %s is not allowed to attest service accounts in namespace %s: namespace does not match the namespace selector", t.Name, namespace)}
+			}
+		}
+	default:
+		return fmt.Errorf("not an issuer type: %t", t)
+	}
+	return nil
+}
+
+// requesterFromRequest returns the identity of the user that created the
+// underlying CertificateRequest or CertificateSigningRequest.
+func requesterFromRequest(cr signer.CertificateRequestObject) (*authenticationv1.UserInfo, error) {
+	obj, ok := cr.(runtime.Object)
+	if !ok {
+		return nil, fmt.Errorf("unsupported request type %T", cr)
+	}
+
+	// The issuer-lib wrappers are unexported, but they embed the API object
+	// so DeepCopyObject hands us back the concrete type.
+	switch t := obj.DeepCopyObject().(type) {
+	case *cmapi.CertificateRequest:
+		return newUserInfo(t.Spec.Username, t.Spec.UID, t.Spec.Groups, t.Spec.Extra), nil
+	case *certificatesv1.CertificateSigningRequest:
+		extra := make(map[string][]string, len(t.Spec.Extra))
+		for k, v := range t.Spec.Extra {
+			extra[k] = v
+		}
+		return newUserInfo(t.Spec.Username, t.Spec.UID, t.Spec.Groups, extra), nil
+	default:
+		return nil, fmt.Errorf("unsupported request type %T", t)
+	}
+}
+
+func newUserInfo(username, uid string, groups []string, extra map[string][]string) *authenticationv1.UserInfo {
+	info := &authenticationv1.UserInfo{
+		Username: username,
+		UID:      uid,
+		Groups:   groups,
+	}
+	if len(extra) > 0 {
+		info.Extra = make(map[string]authenticationv1.ExtraValue, len(extra))
+		for k, v := range extra {
+			info.Extra[k] = v
+		}
+	}
+	return info
+}
+
+// checkRequesterMayUseServiceAccount issues a SubjectAccessReview to verify
+// that the requester holds the configured permission on the ServiceAccount.
+// A denied review is reported as a permanent error since retrying the same
+// request cannot change the outcome.
+func checkRequesterMayUseServiceAccount(ctx context.Context, clientset kubernetes.Interface, authz *athenzissuerapi.RequesterAuthorization, requester *authenticationv1.UserInfo, namespace, serviceAccount string) error {
+	if requester == nil || requester.Username == "" {
+		return signer.PermanentError{Err: fmt.Errorf("request does not record the user that created it")}
+	}
+
+	verb := authz.Verb
+	if verb == "" {
+		verb = "create"
+	}
+	resource, subresource := authz.Resource, authz.Subresource
+	if resource == "" {
+		resource, subresource = "serviceaccounts", "token"
+	}
+
+	extra := make(map[string]authorizationv1.ExtraValue, len(requester.Extra))
+	for k, v := range requester.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+
+	review, err := clientset.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   requester.Username,
+			UID:    requester.UID,
+			Groups: requester.Groups,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace:   namespace,
+				Verb:        verb,
+				Resource:    resource,
+				Subresource: subresource,
+				Name:        serviceAccount,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create subject access review: %w", err)
+	}
+
+	if !review.Status.Allowed || review.Status.Denied {
+		return signer.PermanentError{Err: fmt.Errorf("user %q is not allowed to %s %s in namespace %s for service account %s: %s",
+			requester.Username, verb, resourceString(resource, subresource), namespace, serviceAccount, review.Status.Reason)}
+	}
+	return nil
+}
+
+func resourceString(resource, subresource string) string {
+	if subresource == "" {
+		return resource
+	}
+	return resource + "/" + subresource
+}
@@ -0,0 +1,215 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+	"github.com/cert-manager/issuer-lib/api/v1alpha1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+)
+
+func TestCheckRequesterMayUseServiceAccount(t *testing.T) {
+	// the API server allows alice, denies everyone else and fails for mallory
+	clientset := kubefake.NewSimpleClientset()
+	var reviewed *authorizationv1.SubjectAccessReview
+	clientset.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		reviewed = review
+		switch review.Spec.User {
+		case "mallory":
+			return true, nil, errors.New("authorizer unavailable")
+		case "alice":
+			review.Status.Allowed = true
+		default:
+			review.Status.Reason = "no RBAC policy matched"
+		}
+		return true, review, nil
+	})
+
+	testCases := []struct {
+		name            string
+		authz           athenzissuerapi.RequesterAuthorization
+		requester       *authenticationv1.UserInfo
+		expectedVerb    string
+		expectedTarget  string
+		expectError     bool
+		expectPermanent bool
+	}{
+		{
+			name:           "allowed with the default permission",
+			requester:      &authenticationv1.UserInfo{Username: "alice"},
+			expectedVerb:   "create",
+			expectedTarget: "serviceaccounts/token",
+		},
+		{
+			name:           "allowed with a configured permission",
+			authz:          athenzissuerapi.RequesterAuthorization{Verb: "impersonate", Resource: "serviceaccounts"},
+			requester:      &authenticationv1.UserInfo{Username: "alice"},
+			expectedVerb:   "impersonate",
+			expectedTarget: "serviceaccounts",
+		},
+		{
+			name:            "denied",
+			requester:       &authenticationv1.UserInfo{Username: "bob"},
+			expectedVerb:    "create",
+			expectedTarget:  "serviceaccounts/token",
+			expectError:     true,
+			expectPermanent: true,
+		},
+		{
+			name:            "request without a user",
+			requester:       &authenticationv1.UserInfo{},
+			expectError:     true,
+			expectPermanent: true,
+		},
+		{
+			// retried, the review may pass once the API server recovers
+			name:           "API error",
+			requester:      &authenticationv1.UserInfo{Username: "mallory"},
+			expectedVerb:   "create",
+			expectedTarget: "serviceaccounts/token",
+			expectError:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reviewed = nil
+			err := checkRequesterMayUseServiceAccount(context.Background(), clientset, &tc.authz, tc.requester, "sandbox", "api")
+			if tc.expectError != (err != nil) {
+				t.Fatalf("Expected error=%v, but got %v", tc.expectError, err)
+			}
+			if errors.As(err, &signer.PermanentError{}) != tc.expectPermanent {
+				t.Errorf("Expected permanent=%v, but got %v", tc.expectPermanent, err)
+			}
+			if tc.expectedVerb == "" {
+				if reviewed != nil {
+					t.Errorf("Expected no SubjectAccessReview")
+				}
+				return
+			}
+			attrs := reviewed.Spec.ResourceAttributes
+			if attrs.Verb != tc.expectedVerb || resourceString(attrs.Resource, attrs.Subresource) != tc.expectedTarget || attrs.Namespace != "sandbox" || attrs.Name != "api" {
+				t.Errorf("Unexpected review attributes %+v", attrs)
+			}
+		})
+	}
+}
+
+func TestCheckIssuerMayAttestNamespace(t *testing.T) {
+	namespace := func(name string, labels map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	reader := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		namespace("team-a", map[string]string{"athenz.io/attest": "true"}),
+		namespace("team-b", nil),
+	).Build()
+	failing := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			return errors.New("API server unavailable")
+		},
+	}).Build()
+
+	issuer := &athenzissuerapi.AthenzIssuer{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "athenz"}}
+	clusterIssuer := func(spec athenzissuerapi.AthenzClusterIssuerSpec) *athenzissuerapi.AthenzClusterIssuer {
+		return &athenzissuerapi.AthenzClusterIssuer{ObjectMeta: metav1.ObjectMeta{Name: "athenz"}, Spec: spec}
+	}
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"athenz.io/attest": "true"}}
+
+	testCases := []struct {
+		name            string
+		reader          client.Reader
+		issuer          v1alpha1.Issuer
+		namespace       string
+		expectError     bool
+		expectPermanent bool
+	}{
+		{name: "issuer in its own namespace", issuer: issuer, namespace: "team-a"},
+		{name: "issuer in another namespace", issuer: issuer, namespace: "team-b", expectError: true, expectPermanent: true},
+		{name: "unscoped cluster issuer", issuer: clusterIssuer(athenzissuerapi.AthenzClusterIssuerSpec{}), namespace: "team-b"},
+		{
+			name:      "cluster issuer in an allowed namespace",
+			issuer:    clusterIssuer(athenzissuerapi.AthenzClusterIssuerSpec{AllowedNamespaces: []string{"team-a"}}),
+			namespace: "team-a",
+		},
+		{
+			name:            "cluster issuer outside the allowed namespaces",
+			issuer:          clusterIssuer(athenzissuerapi.AthenzClusterIssuerSpec{AllowedNamespaces: []string{"team-a"}}),
+			namespace:       "team-b",
+			expectError:     true,
+			expectPermanent: true,
+		},
+		{
+			name:      "namespace matching the selector",
+			issuer:    clusterIssuer(athenzissuerapi.AthenzClusterIssuerSpec{NamespaceSelector: selector}),
+			namespace: "team-a",
+		},
+		{
+			name:            "namespace not matching the selector",
+			issuer:          clusterIssuer(athenzissuerapi.AthenzClusterIssuerSpec{NamespaceSelector: selector}),
+			namespace:       "team-b",
+			expectError:     true,
+			expectPermanent: true,
+		},
+		{
+			name:            "allowed namespace not matching the selector",
+			issuer:          clusterIssuer(athenzissuerapi.AthenzClusterIssuerSpec{AllowedNamespaces: []string{"team-b"}, NamespaceSelector: selector}),
+			namespace:       "team-b",
+			expectError:     true,
+			expectPermanent: true,
+		},
+		{
+			name:        "API error looking up the namespace",
+			reader:      failing,
+			issuer:      clusterIssuer(athenzissuerapi.AthenzClusterIssuerSpec{NamespaceSelector: selector}),
+			namespace:   "team-a",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := tc.reader
+			if r == nil {
+				r = reader
+			}
+			err := checkIssuerMayAttestNamespace(context.Background(), r, tc.issuer, tc.namespace)
+			if tc.expectError != (err != nil) {
+				t.Fatalf("Expected error=%v, but got %v", tc.expectError, err)
+			}
+			if errors.As(err, &signer.PermanentError{}) != tc.expectPermanent {
+				t.Errorf("Expected permanent=%v, but got %v", tc.expectPermanent, err)
+			}
+		})
+	}
+}
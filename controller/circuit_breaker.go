@@ -0,0 +1,190 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// circuitBreakerThreshold is the number of consecutive failures after
+	// which the circuit breaker of a ZTS endpoint opens.
+	circuitBreakerThreshold = 5
+
+	// circuitBreakerCooldown is how long an open circuit breaker rejects
+	// calls before it lets a probe through.
+	circuitBreakerCooldown = 30 * time.Second
+)
+
+// circuitOpenError is returned for calls rejected by an open circuit breaker.
+type circuitOpenError struct {
+	endpoint string
+	lastErr  string
+}
+
+func (e *circuitOpenError) Error() string {
+	return fmt.Sprintf("ZTSUnavailable: circuit breaker for %s is open after %d consecutive failures, last error: %s", e.endpoint, circuitBreakerThreshold, e.lastErr)
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker tracks the failures of a ZTS endpoint. It opens after
+// circuitBreakerThreshold consecutive transport errors or 5xx responses, and
+// once the cooldown has passed lets a single probe through. A successful
+// probe closes it again, a failed one restarts the cooldown.
+type circuitBreaker struct {
+	endpoint string
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+	lastErr  string
+	now      func() time.Time
+}
+
+func (b *circuitBreaker) clock() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+	return time.Now()
+}
+
+// allow reports whether a call may go through.
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if b.clock().Sub(b.openedAt) >= circuitBreakerCooldown {
+			b.state = circuitHalfOpen
+			return nil
+		}
+	case circuitHalfOpen:
+		// a probe is in flight
+	default:
+		return nil
+	}
+	return &circuitOpenError{endpoint: b.endpoint, lastErr: b.lastErr}
+}
+
+// record accounts the outcome of a call that was allowed through.
+func (b *circuitBreaker) record(failure error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if failure == nil {
+		b.state, b.failures = circuitClosed, 0
+		ztsCircuitBreakerOpen.WithLabelValues(b.endpoint).Set(0)
+		return
+	}
+	b.failures++
+	b.lastErr = failure.Error()
+	if b.state == circuitHalfOpen || b.failures >= circuitBreakerThreshold {
+		b.state, b.openedAt = circuitOpen, b.clock()
+		ztsCircuitBreakerOpen.WithLabelValues(b.endpoint).Set(1)
+	}
+}
+
+// abandon accounts a call that was cancelled by its caller, which says
+// nothing about the health of the endpoint.
+func (b *circuitBreaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == circuitHalfOpen {
+		// let the next call probe right away
+		b.state = circuitOpen
+	}
+}
+
+func (b *circuitBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state != circuitClosed
+}
+
+// circuitBreakerSet keeps one circuit breaker per ZTS endpoint. The zero value
+// is ready to use.
+type circuitBreakerSet struct {
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func (s *circuitBreakerSet) get(endpoint string) *circuitBreaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.breakers == nil {
+		s.breakers = make(map[string]*circuitBreaker)
+	}
+	b, ok := s.breakers[endpoint]
+	if !ok {
+		b = &circuitBreaker{endpoint: endpoint}
+		s.breakers[endpoint] = b
+	}
+	return b
+}
+
+// breakerTransport passes requests through the circuit breaker of their
+// endpoint.
+type breakerTransport struct {
+	breaker *circuitBreaker
+	base    http.RoundTripper
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	switch {
+	case err != nil && errors.Is(req.Context().Err(), context.Canceled):
+		// timeouts count as failures, cancellations by the caller do not
+		t.breaker.abandon()
+	case err != nil:
+		t.breaker.record(err)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		t.breaker.record(fmt.Errorf("status %d", resp.StatusCode))
+	default:
+		t.breaker.record(nil)
+	}
+	return resp, err
+}
+
+func (t *breakerTransport) CloseIdleConnections() {
+	if tr, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		tr.CloseIdleConnections()
+	}
+}
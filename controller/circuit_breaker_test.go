@@ -0,0 +1,85 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AthenZ/athenz/clients/go/zts"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var healthy atomic.Bool
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			http.Error(w, `{"code":503,"message":"unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"code":200,"message":"ok"}`))
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	breaker := &circuitBreaker{endpoint: server.URL, now: func() time.Time { return now }}
+	client := zts.NewClient(server.URL, &breakerTransport{breaker: breaker})
+
+	for range circuitBreakerThreshold {
+		if _, err := client.GetStatus(); err == nil {
+			t.Fatalf("Expected the stand-in to fail")
+		}
+	}
+	if !breaker.isOpen() {
+		t.Fatalf("Expected the circuit breaker to open after %d failures", circuitBreakerThreshold)
+	}
+
+	// open: calls are rejected without reaching ZTS
+	_, err := client.GetStatus()
+	var open *circuitOpenError
+	if !errors.As(err, &open) {
+		t.Errorf("Expected a circuit open error, got %v", err)
+	}
+	if calls.Load() != circuitBreakerThreshold {
+		t.Errorf("Expected no call to reach ZTS while open, got %d calls", calls.Load())
+	}
+
+	// a failed probe restarts the cooldown
+	now = now.Add(circuitBreakerCooldown)
+	if _, err := client.GetStatus(); err == nil || errors.As(err, &open) {
+		t.Errorf("Expected the probe to reach ZTS and fail, got %v", err)
+	}
+	if _, err := client.GetStatus(); !errors.As(err, &open) {
+		t.Errorf("Expected the circuit breaker to open again after a failed probe, got %v", err)
+	}
+
+	// a successful probe closes it
+	healthy.Store(true)
+	now = now.Add(circuitBreakerCooldown)
+	if _, err := client.GetStatus(); err != nil {
+		t.Fatalf("Unexpected error for the probe: %v", err)
+	}
+	if breaker.isOpen() {
+		t.Errorf("Expected the circuit breaker to close after a successful probe")
+	}
+}
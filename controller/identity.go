@@ -0,0 +1,109 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	issuerutil "github.com/AthenZ/athenz-issuer/internal"
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	compatibilityCSIDriver       = "CSIDriver"
+	compatibilityCSIDriverSPIFFE = "CSIDriverSPIFFE"
+)
+
+// workloadAnnotationKeys returns the annotation keys configured on the issuer,
+// falling back to the defaults for every attribute that is not configured.
+func workloadAnnotationKeys(config *athenzissuerapi.IdentityAnnotations) issuerutil.WorkloadAnnotationKeys {
+	keys := issuerutil.DefaultWorkloadAnnotationKeys
+	if config == nil {
+		return keys
+	}
+
+	if len(config.SpiffeURI) > 0 {
+		keys.SpiffeURI = config.SpiffeURI
+	}
+	keys = issuerutil.WorkloadAnnotationKeys{SpiffeURI: keys.SpiffeURI}.Merge(issuerutil.WorkloadAnnotationKeys{
+		PodName:        config.PodName,
+		PodNamespace:   config.PodNamespace,
+		PodUID:         config.PodUID,
+		ServiceAccount: config.ServiceAccount,
+	})
+
+	switch config.Compatibility {
+	case compatibilityCSIDriver, compatibilityCSIDriverSPIFFE:
+		keys = keys.Merge(issuerutil.CSIPodInfoAnnotationKeys)
+	}
+	return keys
+}
+
+// resolveIdentity works out the workload identity a request is made for from
+// its annotations and CSR.
+func resolveIdentity(ctx context.Context, cr signer.CertificateRequestObject, csrBytes []byte, spec *athenzissuerapi.AthenzCertificateSource) (*issuerutil.SpiffeIdentity, issuerutil.WorkloadAnnotations, error) {
+	workload := issuerutil.ExtractWorkloadAnnotations(cr.GetAnnotations(), workloadAnnotationKeys(spec.IdentityAnnotations))
+
+	if spec.IstioCSR != nil {
+		identity, err := istioIdentity(cr.GetAnnotations(), spec.IstioCSR)
+		return identity, workload, err
+	}
+
+	spiffeURI := workload.SpiffeURI
+	if spec.IdentityAnnotations != nil && spec.IdentityAnnotations.Compatibility == compatibilityCSIDriverSPIFFE {
+		// csi-driver-spiffe puts the SPIFFE ID in the CSR
+		if uri, err := issuerutil.ExtractSpiffeURIFromCSR(csrBytes); err == nil {
+			spiffeURI = uri
+		}
+	}
+	if spiffeURI == "" {
+		ctrl.LoggerFrom(ctx).V(1).Info("No SPIFFE ID in the request annotations, reading it from the CSR")
+		spiffeURI, _ = issuerutil.ExtractSpiffeURIFromCSR(csrBytes)
+	}
+
+	var identity *issuerutil.SpiffeIdentity
+	switch {
+	case spiffeURI != "":
+		ctrl.LoggerFrom(ctx).V(1).Info("Resolved the SPIFFE ID of the request", "spiffeURI", spiffeURI)
+		var err error
+		identity, err = issuerutil.ParseSpiffeURI(spiffeURI, issuerutil.SpiffeURIFormat(spec.SpiffeURIFormat))
+		if err != nil {
+			return nil, workload, signer.PermanentError{Err: fmt.Errorf("unable to parse spiffe uri %q: %w", spiffeURI, err)}
+		}
+	case workload.ServiceAccount != "":
+		identity = issuerutil.IdentityFromServiceAccount(workload.PodNamespace, workload.ServiceAccount)
+	default:
+		return nil, workload, signer.PermanentError{Err: fmt.Errorf("unable to find the workload identity in the request annotations or CSR")}
+	}
+
+	if identity.Namespace == "" {
+		// the Athenz service format does not carry a namespace, the
+		// workload has to live in the namespace of the request
+		if cr.GetNamespace() == "" {
+			return nil, workload, signer.PermanentError{Err: fmt.Errorf("workload identity does not name a namespace and the request is not namespaced")}
+		}
+		identity.Namespace = cr.GetNamespace()
+	}
+	if workload.PodNamespace != "" && workload.PodNamespace != identity.Namespace {
+		return nil, workload, signer.PermanentError{Err: fmt.Errorf("pod namespace %s does not match the namespace %s of the workload identity", workload.PodNamespace, identity.Namespace)}
+	}
+
+	return identity, workload, nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+
+	issuerutil "github.com/AthenZ/athenz-issuer/internal"
+)
+
+// issuedCertificateClockSkew is how far in the future the validity of an
+// issued certificate may start, to allow for clocks that are slightly off.
+const issuedCertificateClockSkew = time.Minute
+
+// verifyIssuedCertificate checks the certificate chain ZTS returned for a
+// request: the leaf has to be for the public key of the CSR and the requested
+// identity, be valid now, and chain to the CA bundle of the issuer. Without a
+// CA bundle there is nothing but ZTS itself to verify the chain against, it is
+// then not verified and false is returned.
+func verifyIssuedCertificate(chainPEM, caBundle []byte, publicKey crypto.PublicKey, identity *issuerutil.SpiffeIdentity, now time.Time) (bool, error) {
+	chain, err := issuerutil.ParseCertificatesPEM(chainPEM)
+	if err != nil {
+		return false, fmt.Errorf("unable to parse the certificate chain: %w", err)
+	}
+	if len(chain) == 0 {
+		return false, fmt.Errorf("the certificate chain is empty")
+	}
+	leaf := chain[0]
+
+	if key, ok := publicKey.(interface{ Equal(crypto.PublicKey) bool }); !ok || !key.Equal(leaf.PublicKey) {
+		return false, fmt.Errorf("the public key of certificate %s does not match the CSR", leaf.Subject.CommonName)
+	}
+	if !isAthenzServiceCertificate(leaf, identity) {
+		return false, fmt.Errorf("certificate %s is not for the athenz service %s.%s", leaf.Subject.CommonName, identity.Domain, identity.Service)
+	}
+	if now.Add(issuedCertificateClockSkew).Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		return false, fmt.Errorf("certificate %s is only valid from %s to %s", leaf.Subject.CommonName, leaf.NotBefore.Format(time.RFC3339), leaf.NotAfter.Format(time.RFC3339))
+	}
+
+	if len(caBundle) == 0 {
+		return false, nil
+	}
+	roots, err := issuerutil.ParseCertificatesPEM(caBundle)
+	if err != nil {
+		return false, fmt.Errorf("unable to parse the CA bundle of the issuer: %w", err)
+	}
+	opts := x509.VerifyOptions{
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+		// a leaf that starts within the clock skew is verified as of its start
+		CurrentTime: now,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	if opts.CurrentTime.Before(leaf.NotBefore) {
+		opts.CurrentTime = leaf.NotBefore
+	}
+	for _, root := range roots {
+		opts.Roots.AddCert(root)
+	}
+	for _, intermediate := range chain[1:] {
+		opts.Intermediates.AddCert(intermediate)
+	}
+	if _, err := leaf.Verify(opts); err != nil {
+		return false, fmt.Errorf("certificate %s does not chain to the CA bundle of the issuer: %w", leaf.Subject.CommonName, err)
+	}
+	return true, nil
+}
+
+// isAthenzServiceCertificate reports whether cert is for the requested
+// identity: it names <domain>.<service> in its common name, or in a SPIFFE
+// URI SAN either spiffe://<domain>/sa/<service> or, in the trust domain and
+// namespace of the identity, spiffe://<trust-domain>/ns/<namespace>/sa/<domain>.<service>.
+func isAthenzServiceCertificate(cert *x509.Certificate, identity *issuerutil.SpiffeIdentity) bool {
+	name := identity.Domain + "." + identity.Service
+	if strings.EqualFold(cert.Subject.CommonName, name) {
+		return true
+	}
+	for _, uri := range cert.URIs {
+		if uri.Scheme != "spiffe" {
+			continue
+		}
+		if strings.EqualFold(uri.Host, identity.Domain) && uri.Path == "/sa/"+identity.Service {
+			return true
+		}
+		if identity.TrustDomain != "" && strings.EqualFold(uri.Host, identity.TrustDomain) && uri.Path == "/ns/"+identity.Namespace+"/sa/"+name {
+			return true
+		}
+	}
+	return false
+}
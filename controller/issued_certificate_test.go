@@ -0,0 +1,184 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	issuerutil "github.com/AthenZ/athenz-issuer/internal"
+)
+
+func TestVerifyIssuedCertificate(t *testing.T) {
+	root, rootKey := newTestCA(t, "root", nil, nil)
+	intermediate, intermediateKey := newTestCA(t, "intermediate", root, rootKey)
+	otherRoot, _ := newTestCA(t, "other", nil, nil)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	leaf := func(cn string, uri string, notBefore, notAfter time.Time) *x509.Certificate {
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(now.UnixNano()),
+			Subject:      pkix.Name{CommonName: cn},
+			NotBefore:    notBefore,
+			NotAfter:     notAfter,
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		if uri != "" {
+			u, err := url.Parse(uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+			template.URIs = []*url.URL{u}
+		}
+		raw, err := x509.CreateCertificate(rand.Reader, template, intermediate, &key.PublicKey, intermediateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	encode := func(certs ...*x509.Certificate) []byte {
+		return issuerutil.EncodeCertificatesPEM(certs)
+	}
+	valid := leaf("athenz.prod.api", "", now.Add(-time.Minute), now.Add(time.Hour))
+
+	testCases := []struct {
+		name             string
+		chain            []byte
+		caBundle         []byte
+		publicKey        any
+		expectUnverified bool
+		expectError      bool
+	}{
+		{
+			name:     "chains to the CA bundle",
+			chain:    encode(valid, intermediate),
+			caBundle: encode(root),
+		},
+		{
+			name:             "no CA bundle to verify the chain against",
+			chain:            encode(valid, intermediate),
+			expectUnverified: true,
+		},
+		{
+			name:     "identity in a SPIFFE URI",
+			chain:    encode(leaf("workload", "spiffe://athenz.prod/sa/api", now.Add(-time.Minute), now.Add(time.Hour)), intermediate),
+			caBundle: encode(root),
+		},
+		{
+			name:     "identity in a namespaced SPIFFE URI",
+			chain:    encode(leaf("workload", "spiffe://cluster.local/ns/prod/sa/athenz.prod.api", now.Add(-time.Minute), now.Add(time.Hour)), intermediate),
+			caBundle: encode(root),
+		},
+		{
+			name:        "namespaced SPIFFE URI of another trust domain",
+			chain:       encode(leaf("workload", "spiffe://evil.example/ns/prod/sa/athenz.prod.api", now.Add(-time.Minute), now.Add(time.Hour)), intermediate),
+			caBundle:    encode(root),
+			expectError: true,
+		},
+		{
+			name:        "namespaced SPIFFE URI of another namespace",
+			chain:       encode(leaf("workload", "spiffe://cluster.local/ns/sandbox/sa/athenz.prod.api", now.Add(-time.Minute), now.Add(time.Hour)), intermediate),
+			caBundle:    encode(root),
+			expectError: true,
+		},
+		{
+			name:     "valid within the clock skew",
+			chain:    encode(leaf("athenz.prod.api", "", now.Add(issuedCertificateClockSkew/2), now.Add(time.Hour)), intermediate),
+			caBundle: encode(root),
+		},
+		{
+			name:        "empty chain",
+			caBundle:    encode(root),
+			expectError: true,
+		},
+		{
+			name:        "public key of another CSR",
+			chain:       encode(valid, intermediate),
+			caBundle:    encode(root),
+			publicKey:   &otherKey.PublicKey,
+			expectError: true,
+		},
+		{
+			name:        "another service",
+			chain:       encode(leaf("athenz.prod.web", "spiffe://athenz.prod/sa/web", now.Add(-time.Minute), now.Add(time.Hour)), intermediate),
+			caBundle:    encode(root),
+			expectError: true,
+		},
+		{
+			name:        "expired",
+			chain:       encode(leaf("athenz.prod.api", "", now.Add(-2*time.Hour), now.Add(-time.Hour)), intermediate),
+			caBundle:    encode(root),
+			expectError: true,
+		},
+		{
+			name:        "not valid yet",
+			chain:       encode(leaf("athenz.prod.api", "", now.Add(time.Hour), now.Add(2*time.Hour)), intermediate),
+			caBundle:    encode(root),
+			expectError: true,
+		},
+		{
+			name:        "another CA",
+			chain:       encode(valid, intermediate),
+			caBundle:    encode(otherRoot),
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			publicKey := tc.publicKey
+			if publicKey == nil {
+				publicKey = &key.PublicKey
+			}
+			identity := &issuerutil.SpiffeIdentity{TrustDomain: "cluster.local", Namespace: "prod", Domain: "athenz.prod", Service: "api"}
+			verified, err := verifyIssuedCertificate(tc.chain, tc.caBundle, publicKey, identity, now)
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if verified == tc.expectUnverified {
+				t.Errorf("Expected the chain to be verified=%v, but got %v", !tc.expectUnverified, verified)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+)
+
+// issuerCheckFieldOwner owns the check fields of the issuer status.
+const issuerCheckFieldOwner = "athenzissuer.cert-manager.athenz.io/check"
+
+// issuerHealthSet remembers whether the last check of every issuer passed.
+// The zero value is ready to use.
+type issuerHealthSet struct {
+	mu      sync.Mutex
+	healthy map[types.NamespacedName]bool
+}
+
+func (s *issuerHealthSet) set(issuer types.NamespacedName, healthy bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.healthy == nil {
+		s.healthy = make(map[types.NamespacedName]bool)
+	}
+	s.healthy[issuer] = healthy
+}
+
+// retain forgets the issuers that are not in issuers.
+func (s *issuerHealthSet) retain(issuers map[types.NamespacedName]bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for issuer := range s.healthy {
+		if !issuers[issuer] {
+			delete(s.healthy, issuer)
+		}
+	}
+}
+
+// count returns the number of issuers checked and of those that passed.
+func (s *issuerHealthSet) count() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	healthy := 0
+	for _, ok := range s.healthy {
+		if ok {
+			healthy++
+		}
+	}
+	return len(s.healthy), healthy
+}
+
+// ReadyzCheck reports whether the issuers of the controller are healthy. It
+// only fails when requireHealthyIssuer is set and none of the issuers checked
+// passed its last check, a controller without issuers is ready. Issuers are
+// only checked by the leader, replicas waiting for the leader lease are always
+// ready.
+func (s *Signer) ReadyzCheck(requireHealthyIssuer bool) healthz.Checker {
+	return func(_ *http.Request) error {
+		if !requireHealthyIssuer {
+			return nil
+		}
+		if s.elected != nil {
+			select {
+			case <-s.elected:
+			default:
+				return nil
+			}
+		}
+		if checked, healthy := s.issuerHealth.count(); checked > 0 && healthy == 0 {
+			return fmt.Errorf("none of the %d issuers checked is healthy", checked)
+		}
+		return nil
+	}
+}
+
+// recheckIssuers requeues every issuer each CheckInterval, so that its Ready
+// condition follows the health of ZTS rather than only changes to the issuer.
+func (s *Signer) recheckIssuers(ctx context.Context) error {
+	logger := ctrl.Log.WithName("issuer-check")
+	ticker := time.NewTicker(s.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		issuers := &athenzissuerapi.AthenzIssuerList{}
+		clusterIssuers := &athenzissuerapi.AthenzClusterIssuerList{}
+		if err := s.kubeClient.List(ctx, issuers); err != nil {
+			logger.Error(err, "Failed to list issuers")
+			continue
+		}
+		if err := s.kubeClient.List(ctx, clusterIssuers); err != nil {
+			logger.Error(err, "Failed to list cluster issuers")
+			continue
+		}
+
+		objects := make(map[string][]client.Object)
+		for i := range issuers.Items {
+			objects["AthenzIssuer"] = append(objects["AthenzIssuer"], &issuers.Items[i])
+		}
+		for i := range clusterIssuers.Items {
+			objects["AthenzClusterIssuer"] = append(objects["AthenzClusterIssuer"], &clusterIssuers.Items[i])
+		}
+
+		existing := make(map[types.NamespacedName]bool)
+		for kind, objs := range objects {
+			for _, obj := range objs {
+				existing[types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}] = true
+				select {
+				case s.recheck[kind] <- event.GenericEvent{Object: obj}:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		}
+		s.issuerHealth.retain(existing)
+	}
+}
+
+// applyIssuerStatus applies fields of the status of an issuer as fieldOwner.
+// Every set of fields the controller writes has its own owner, issuer-lib
+// would otherwise drop them when it updates the conditions.
+func (s *Signer) applyIssuerStatus(ctx context.Context, issuer client.Object, fieldOwner string, status map[string]any) error {
+	obj := issuer.DeepCopyObject().(client.Object)
+	gvk, err := s.kubeClient.GroupVersionKindFor(obj)
+	if err != nil {
+		return err
+	}
+	metadata := map[string]any{"name": obj.GetName()}
+	if obj.GetNamespace() != "" {
+		metadata["namespace"] = obj.GetNamespace()
+	}
+	patch, err := json.Marshal(map[string]any{
+		"apiVersion": gvk.GroupVersion().String(),
+		"kind":       gvk.Kind,
+		"metadata":   metadata,
+		"status":     status,
+	})
+	if err != nil {
+		return err
+	}
+	return s.kubeClient.Status().Patch(ctx, obj, client.RawPatch(types.ApplyPatchType, patch), client.FieldOwner(fieldOwner), client.ForceOwnership)
+}
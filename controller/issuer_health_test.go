@@ -0,0 +1,204 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	issuerutil "github.com/AthenZ/athenz-issuer/internal"
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+)
+
+func TestCheckCallsZTS(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	server, calls := newStatusZTS(t, &healthy)
+
+	issuer := &athenzissuerapi.AthenzIssuer{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "sandbox", Name: "athenz"},
+		Spec:       athenzissuerapi.AthenzCertificateSource{ZTSEndpoint: server.URL, Cloud: "aws", Region: "us-east-1", ProviderPrefix: "athenz"},
+	}
+	s := &Signer{}
+	name := types.NamespacedName{Namespace: "sandbox", Name: "athenz"}
+
+	if err := s.Check(context.Background(), issuer); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected the check to call ZTS once, got %d calls", calls.Load())
+	}
+	if checked, ok := s.issuerHealth.count(); checked != 1 || ok != 1 {
+		t.Errorf("Expected the issuer to be recorded as healthy")
+	}
+
+	healthy.Store(false)
+	if err := s.Check(context.Background(), issuer); err == nil {
+		t.Fatalf("Expected the check to fail while ZTS is unavailable")
+	}
+	if _, ok := s.issuerHealth.count(); ok != 0 {
+		t.Errorf("Expected the issuer to be recorded as unhealthy")
+	}
+
+	// issuers in local mode never talk to ZTS
+	issuer.Spec.Cloud = "local"
+	if err := s.Check(context.Background(), issuer); err != nil {
+		t.Fatalf("Unexpected error in local mode: %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected no ZTS call in local mode, got %d calls", calls.Load())
+	}
+
+	s.issuerHealth.retain(map[types.NamespacedName]bool{})
+	if checked, _ := s.issuerHealth.count(); checked != 0 {
+		t.Errorf("Expected deleted issuers to be forgotten, %s is still known", name)
+	}
+}
+
+func TestCheckAuthentication(t *testing.T) {
+	// a ZTS that turns away every caller
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"code":401,"message":"authentication required"}`, http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	cert, key := newTestCA(t, "athenz.k8s.issuer", nil, nil)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Signer{
+		apiReader: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "sandbox", Name: "issuer-credentials"},
+			Type:       corev1.SecretTypeTLS,
+			Data: map[string][]byte{
+				corev1.TLSCertKey:       issuerutil.EncodeCertificatesPEM([]*x509.Certificate{cert}),
+				corev1.TLSPrivateKeyKey: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+			},
+		}).Build(),
+	}
+	issuer := &athenzissuerapi.AthenzIssuer{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "sandbox", Name: "athenz"},
+		Spec:       athenzissuerapi.AthenzCertificateSource{ZTSEndpoint: server.URL, Cloud: "aws", Region: "us-east-1", ProviderPrefix: "athenz"},
+	}
+
+	// without credentials ZTS answering is all the check can show
+	_, authenticated, err := s.check(context.Background(), issuer)
+	if err != nil {
+		t.Fatalf("Expected an unauthenticated check to pass once ZTS answers, got %v", err)
+	}
+	if authenticated {
+		t.Errorf("Expected the check not to be reported as authenticated")
+	}
+
+	// with credentials ZTS has to accept them
+	issuer.Spec.CredentialsSecretRef = &athenzissuerapi.LocalObjectReference{Name: "issuer-credentials"}
+	if _, _, err := s.check(context.Background(), issuer); err == nil {
+		t.Errorf("Expected the check to fail when ZTS rejects the issuer credentials")
+	}
+}
+
+func TestCheckRecordsChainVerification(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := athenzissuerapi.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	var status map[string]any
+	s := &Signer{
+		kubeClient: fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+			SubResourcePatch: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+				data, err := patch.Data(obj)
+				if err != nil {
+					return err
+				}
+				var applied struct {
+					Status map[string]any `json:"status"`
+				}
+				if err := json.Unmarshal(data, &applied); err != nil {
+					return err
+				}
+				status = applied.Status
+				return nil
+			},
+		}).Build(),
+	}
+
+	cert, _ := newTestCA(t, "athenz.ca", nil, nil)
+	testCases := []struct {
+		name     string
+		caBundle []byte
+		expected bool
+	}{
+		{name: "without a caBundle", expected: false},
+		{name: "with a caBundle", caBundle: issuerutil.EncodeCertificatesPEM([]*x509.Certificate{cert}), expected: true},
+	}
+
+	for _, tc := range testCases {
+		status = nil
+		issuer := &athenzissuerapi.AthenzIssuer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "sandbox", Name: "athenz"},
+			Spec:       athenzissuerapi.AthenzCertificateSource{ZTSEndpoint: "https://zts.example/zts/v1", Cloud: "local", CABundle: tc.caBundle},
+		}
+		if err := s.Check(context.Background(), issuer); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if verified, ok := status["chainVerified"].(bool); !ok || verified != tc.expected {
+			t.Errorf("%s: expected chainVerified=%v in the status, got %v", tc.name, tc.expected, status)
+		}
+	}
+}
+
+func TestReadyzCheck(t *testing.T) {
+	elected := make(chan struct{})
+	s := &Signer{elected: elected}
+	name := types.NamespacedName{Namespace: "sandbox", Name: "athenz"}
+
+	if err := s.ReadyzCheck(false)(nil); err != nil {
+		t.Errorf("Expected the check to pass when not required, got %v", err)
+	}
+	if err := s.ReadyzCheck(true)(nil); err != nil {
+		t.Errorf("Expected a replica that does not lead to be ready, got %v", err)
+	}
+
+	close(elected)
+	if err := s.ReadyzCheck(true)(nil); err != nil {
+		t.Errorf("Expected the leader without issuers to be ready, got %v", err)
+	}
+	s.issuerHealth.set(name, false)
+	if err := s.ReadyzCheck(true)(nil); err == nil {
+		t.Errorf("Expected the leader without healthy issuers not to be ready")
+	}
+	s.issuerHealth.set(types.NamespacedName{Name: "cluster"}, true)
+	if err := s.ReadyzCheck(true)(nil); err != nil {
+		t.Errorf("Expected the leader with a healthy issuer to be ready, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/x509"
+	"fmt"
+	"slices"
+	"strings"
+
+	issuerutil "github.com/AthenZ/athenz-issuer/internal"
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+)
+
+const (
+	// istioCSRIdentitiesAnnotation is set by istio-csr on every request it
+	// creates to the SPIFFE identity the workload authenticated as.
+	istioCSRIdentitiesAnnotation = "istio.cert-manager.io/identities"
+
+	defaultIstioTrustDomain = "cluster.local"
+)
+
+// istioIdentity maps the identity istio-csr requested a certificate for to an
+// Athenz service.
+func istioIdentity(annotations map[string]string, config *athenzissuerapi.IstioCSR) (*issuerutil.SpiffeIdentity, error) {
+	var identities []string
+	for _, id := range strings.Split(annotations[istioCSRIdentitiesAnnotation], ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			identities = append(identities, id)
+		}
+	}
+	if len(identities) != 1 {
+		return nil, signer.PermanentError{Err: fmt.Errorf("expected exactly one identity in the %s annotation, found %d", istioCSRIdentitiesAnnotation, len(identities))}
+	}
+
+	identity, err := issuerutil.ParseSpiffeURI(identities[0], issuerutil.SpiffeURIFormatKubernetes)
+	if err != nil {
+		return nil, signer.PermanentError{Err: fmt.Errorf("unable to parse istio identity %q: %w", identities[0], err)}
+	}
+
+	trustDomain := config.TrustDomain
+	if trustDomain == "" {
+		trustDomain = defaultIstioTrustDomain
+	}
+	if !strings.EqualFold(identity.TrustDomain, trustDomain) {
+		return nil, signer.PermanentError{Err: fmt.Errorf("istio identity %q is not in the mesh trust domain %s", identities[0], trustDomain)}
+	}
+
+	if config.DomainPrefix != "" {
+		identity.Domain = config.DomainPrefix + "." + identity.Namespace
+		identity.Service = identity.ServiceAccount
+	} else if identity.Domain == "" {
+		return nil, signer.PermanentError{Err: fmt.Errorf("service account %s of istio identity %q is not of the form <domain>.<service>", identity.ServiceAccount, identities[0])}
+	}
+	return identity, nil
+}
+
+// istioCSRBundle returns the issued certificate the way istio-csr consumes it:
+// the leaf followed by its intermediates as the chain and the root as the CA.
+func istioCSRBundle(certificatePEM, signerPEM []byte) (signer.PEMBundle, error) {
+	chain, err := issuerutil.ParseCertificatesPEM(certificatePEM)
+	if err != nil {
+		return signer.PEMBundle{}, err
+	}
+	if len(chain) == 0 {
+		return signer.PEMBundle{}, fmt.Errorf("no certificate returned")
+	}
+	signers, err := issuerutil.ParseCertificatesPEM(signerPEM)
+	if err != nil {
+		return signer.PEMBundle{}, err
+	}
+
+	var intermediates, roots []*x509.Certificate
+	for _, cert := range slices.Concat(chain[1:], signers) {
+		switch {
+		case issuerutil.IsSelfSigned(cert):
+			if !containsCertificate(roots, cert) {
+				roots = append(roots, cert)
+			}
+		case !containsCertificate(intermediates, cert):
+			intermediates = append(intermediates, cert)
+		}
+	}
+	if len(roots) == 0 && len(intermediates) > 0 {
+		// no root was handed out, the top of the chain is our best guess
+		roots = intermediates[len(intermediates)-1:]
+	}
+
+	return signer.PEMBundle{
+		ChainPEM: issuerutil.EncodeCertificatesPEM(slices.Concat(chain[:1], intermediates)),
+		CAPEM:    issuerutil.EncodeCertificatesPEM(roots),
+	}, nil
+}
+
+func containsCertificate(certs []*x509.Certificate, cert *x509.Certificate) bool {
+	return slices.ContainsFunc(certs, cert.Equal)
+}
@@ -0,0 +1,185 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	issuerutil "github.com/AthenZ/athenz-issuer/internal"
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+)
+
+func TestIstioIdentity(t *testing.T) {
+	testCases := []struct {
+		name            string
+		identities      string
+		config          athenzissuerapi.IstioCSR
+		expectedDomain  string
+		expectedService string
+		expectError     bool
+	}{
+		{
+			name:            "service account named after the athenz service",
+			identities:      "spiffe://cluster.local/ns/sandbox/sa/athenz.prod.httpbin",
+			expectedDomain:  "athenz.prod",
+			expectedService: "httpbin",
+		},
+		{
+			name:            "namespace mapped to a domain",
+			identities:      "spiffe://mesh.example/ns/sandbox/sa/httpbin",
+			config:          athenzissuerapi.IstioCSR{TrustDomain: "mesh.example", DomainPrefix: "athenz.mesh"},
+			expectedDomain:  "athenz.mesh.sandbox",
+			expectedService: "httpbin",
+		},
+		{
+			name:        "service account without a domain",
+			identities:  "spiffe://cluster.local/ns/sandbox/sa/httpbin",
+			expectError: true,
+		},
+		{
+			name:        "foreign trust domain",
+			identities:  "spiffe://evil.example/ns/sandbox/sa/athenz.prod.httpbin",
+			expectError: true,
+		},
+		{
+			name:        "multiple identities",
+			identities:  "spiffe://cluster.local/ns/sandbox/sa/athenz.prod.a,spiffe://cluster.local/ns/sandbox/sa/athenz.prod.b",
+			expectError: true,
+		},
+		{
+			name:        "missing annotation",
+			identities:  "",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			identity, err := istioIdentity(map[string]string{istioCSRIdentitiesAnnotation: tc.identities}, &tc.config)
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("Expected an error for identities: %s", tc.identities)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error for identities: %s - %v", tc.identities, err)
+			}
+			if identity.Domain != tc.expectedDomain || identity.Service != tc.expectedService {
+				t.Errorf("Expected %s.%s, but got %s.%s", tc.expectedDomain, tc.expectedService, identity.Domain, identity.Service)
+			}
+		})
+	}
+}
+
+func TestIstioCSRBundle(t *testing.T) {
+	root, rootKey := newTestCA(t, "root", nil, nil)
+	intermediate, intermediateKey := newTestCA(t, "intermediate", root, rootKey)
+	leaf, _ := newTestCA(t, "leaf", intermediate, intermediateKey)
+
+	encode := func(certs ...*x509.Certificate) []byte {
+		return issuerutil.EncodeCertificatesPEM(certs)
+	}
+
+	testCases := []struct {
+		name          string
+		certificate   []byte
+		signer        []byte
+		expectedChain []byte
+		expectedCA    []byte
+	}{
+		{
+			name:          "signer bundle with the root",
+			certificate:   encode(leaf),
+			signer:        encode(intermediate, root),
+			expectedChain: encode(leaf, intermediate),
+			expectedCA:    encode(root),
+		},
+		{
+			name:          "chain already contains the intermediate",
+			certificate:   encode(leaf, intermediate),
+			signer:        encode(intermediate, root),
+			expectedChain: encode(leaf, intermediate),
+			expectedCA:    encode(root),
+		},
+		{
+			name:          "no root handed out",
+			certificate:   encode(leaf),
+			signer:        encode(intermediate),
+			expectedChain: encode(leaf, intermediate),
+			expectedCA:    encode(intermediate),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bundle, err := istioCSRBundle(tc.certificate, tc.signer)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(bundle.ChainPEM) != string(tc.expectedChain) {
+				t.Errorf("Unexpected chain:\n%s", bundle.ChainPEM)
+			}
+			if string(bundle.CAPEM) != string(tc.expectedCA) {
+				t.Errorf("Unexpected CA:\n%s", bundle.CAPEM)
+			}
+		})
+	}
+
+	if _, err := istioCSRBundle(nil, encode(root)); err == nil {
+		t.Errorf("Expected an error without a certificate")
+	}
+}
+
+// newTestCA issues a CA certificate signed by parent, or a self-signed root
+// when parent is nil.
+func newTestCA(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
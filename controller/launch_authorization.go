@@ -0,0 +1,121 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/AthenZ/athenz/clients/go/zts"
+	"k8s.io/apimachinery/pkg/types"
+
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+)
+
+const (
+	defaultLaunchAction                = "launch"
+	defaultLaunchAuthorizationCacheTTL = 30 * time.Second
+
+	// maxLaunchAuthorizationCacheEntries bounds the cache, expired entries
+	// are dropped once it is reached.
+	maxLaunchAuthorizationCacheEntries = 4096
+)
+
+type launchAuthorizationEntry struct {
+	granted bool
+	expires time.Time
+}
+
+// launchAuthorizationCache remembers ZTS access check answers for a short
+// time so that renewal storms do not turn into one access check per request.
+// The zero value is ready to use.
+type launchAuthorizationCache struct {
+	mu      sync.Mutex
+	entries map[string]launchAuthorizationEntry
+	now     func() time.Time
+}
+
+func (c *launchAuthorizationCache) get(key string) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || !c.clock().Before(entry.expires) {
+		return false, false
+	}
+	return entry.granted, true
+}
+
+func (c *launchAuthorizationCache) set(key string, granted bool, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock()
+	if c.entries == nil {
+		c.entries = make(map[string]launchAuthorizationEntry)
+	}
+	if len(c.entries) >= maxLaunchAuthorizationCacheEntries {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	if len(c.entries) < maxLaunchAuthorizationCacheEntries {
+		c.entries[key] = launchAuthorizationEntry{granted: granted, expires: now.Add(ttl)}
+	}
+}
+
+func (c *launchAuthorizationCache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// checkLaunchAuthorization asks ZTS whether the namespace principal may launch
+// domain.service. Denials are returned as (false, nil), errors talking to ZTS
+// are returned as is so the request is retried. Answers are cached per issuer
+// since each issuer asks ZTS with its own credentials.
+func (c *launchAuthorizationCache) checkLaunchAuthorization(client zts.ZTSClient, issuer types.NamespacedName, authz *athenzissuerapi.LaunchAuthorization, namespace, domain, service string) (bool, string, error) {
+	action := authz.Action
+	if action == "" {
+		action = defaultLaunchAction
+	}
+	ttl := defaultLaunchAuthorizationCacheTTL
+	if authz.CacheDuration != nil {
+		ttl = authz.CacheDuration.Duration
+	}
+	principal := fmt.Sprintf("%s.%s", authz.PrincipalPrefix, namespace)
+	resource := fmt.Sprintf("%s:service.%s", domain, service)
+
+	key := issuer.String() + "|" + client.URL + "|" + action + "|" + resource + "|" + principal
+	if granted, ok := c.get(key); ok {
+		return granted, principal, nil
+	}
+
+	access, err := client.GetResourceAccessExt(zts.ActionName(action), resource, "", zts.EntityName(principal))
+	if err != nil {
+		return false, principal, fmt.Errorf("failed to check %s access on %s for %s: %w", action, resource, principal, err)
+	}
+	granted := access != nil && access.Granted
+	if ttl > 0 {
+		c.set(key, granted, ttl)
+	}
+	return granted, principal, nil
+}
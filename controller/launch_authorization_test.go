@@ -0,0 +1,153 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AthenZ/athenz/clients/go/zts"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+)
+
+// newLaunchAccessZTS starts a ZTS stand-in that grants the launch action on
+// athenz.prod:service.api to the principals in granted.
+func newLaunchAccessZTS(t *testing.T, granted ...string) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path != "/access/launch" {
+			http.NotFound(w, r)
+			return
+		}
+		allowed := false
+		for _, p := range granted {
+			if r.URL.Query().Get("principal") == p && r.URL.Query().Get("resource") == "athenz.prod:service.api" {
+				allowed = true
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"granted":%t}`, allowed)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestCheckLaunchAuthorization(t *testing.T) {
+	server, calls := newLaunchAccessZTS(t, "athenz.k8s.cluster.team-a")
+	client := zts.NewClient(server.URL, nil)
+	authz := &athenzissuerapi.LaunchAuthorization{PrincipalPrefix: "athenz.k8s.cluster"}
+	issuer := types.NamespacedName{Name: "athenz"}
+
+	now := time.Now()
+	cache := &launchAuthorizationCache{now: func() time.Time { return now }}
+
+	testCases := []struct {
+		namespace     string
+		expected      bool
+		expectedCalls int32
+	}{
+		{namespace: "team-a", expected: true, expectedCalls: 1},
+		// served from the cache
+		{namespace: "team-a", expected: true, expectedCalls: 1},
+		{namespace: "team-b", expected: false, expectedCalls: 2},
+		// denials are cached too
+		{namespace: "team-b", expected: false, expectedCalls: 2},
+	}
+
+	for _, tc := range testCases {
+		granted, principal, err := cache.checkLaunchAuthorization(client, issuer, authz, tc.namespace, "athenz.prod", "api")
+		if err != nil {
+			t.Fatalf("Unexpected error for namespace %s: %v", tc.namespace, err)
+		}
+		if granted != tc.expected {
+			t.Errorf("Expected granted=%v for principal %s, but got %v", tc.expected, principal, granted)
+		}
+		if calls.Load() != tc.expectedCalls {
+			t.Errorf("Expected %d ZTS calls, but got %d", tc.expectedCalls, calls.Load())
+		}
+	}
+
+	// answers are not shared between issuers, each asks with its own credentials
+	if _, _, err := cache.checkLaunchAuthorization(client, types.NamespacedName{Name: "other"}, authz, "team-a", "athenz.prod", "api"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Expected another issuer to ask ZTS itself, got %d calls", calls.Load())
+	}
+
+	// once the entry expires ZTS is asked again
+	now = now.Add(defaultLaunchAuthorizationCacheTTL)
+	if _, _, err := cache.checkLaunchAuthorization(client, issuer, authz, "team-a", "athenz.prod", "api"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if calls.Load() != 4 {
+		t.Errorf("Expected the expired entry to be refreshed from ZTS, got %d calls", calls.Load())
+	}
+
+	// a zero cache duration disables caching
+	uncached := &athenzissuerapi.LaunchAuthorization{PrincipalPrefix: "athenz.k8s.cluster", CacheDuration: &metav1.Duration{}}
+	for range 2 {
+		if _, _, err := (&launchAuthorizationCache{}).checkLaunchAuthorization(client, issuer, uncached, "team-a", "athenz.prod", "api"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if calls.Load() != 6 {
+		t.Errorf("Expected every uncached check to reach ZTS, got %d calls", calls.Load())
+	}
+}
+
+func TestCheckLaunchAuthorizationZTSError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"code":503,"message":"unavailable"}`, http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	cache := &launchAuthorizationCache{}
+	_, _, err := cache.checkLaunchAuthorization(zts.NewClient(server.URL, nil), types.NamespacedName{Name: "athenz"}, &athenzissuerapi.LaunchAuthorization{PrincipalPrefix: "athenz.k8s"}, "team-a", "athenz.prod", "api")
+	if err == nil {
+		t.Fatalf("Expected an error when ZTS is unavailable")
+	}
+	if len(cache.entries) != 0 {
+		t.Errorf("Expected errors not to be cached")
+	}
+}
+
+func TestLaunchAuthorizationRequiresCredentials(t *testing.T) {
+	issuer := &athenzissuerapi.AthenzIssuer{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "sandbox", Name: "athenz"},
+		Spec: athenzissuerapi.AthenzCertificateSource{
+			ZTSEndpoint:         "https://zts.example/zts/v1",
+			Cloud:               "local",
+			LaunchAuthorization: &athenzissuerapi.LaunchAuthorization{PrincipalPrefix: "athenz.k8s"},
+		},
+	}
+	_, _, err := (&Signer{}).check(context.Background(), issuer)
+	if !errors.As(err, &signer.PermanentError{}) {
+		t.Errorf("Expected a permanent error for launch checks without credentials, got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	metricsNamespace = "athenz_issuer"
+
+	// otherTrustDomain is the trust domain label of requests for trust
+	// domains the issuer does not list.
+	otherTrustDomain = "other"
+)
+
+var (
+	// spiffeRequestsTotal counts the SPIFFE identities seen by Sign, by trust
+	// domain and whether the issuer accepted them, see trustDomainLabel.
+	spiffeRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "spiffe_requests_total",
+		Help:      "Number of requests per SPIFFE trust domain (other when the issuer does not list it) and admission result.",
+	}, []string{"trust_domain", "result"})
+
+	// tokenCacheRequestsTotal counts ServiceAccount token cache lookups by
+	// whether a cached token was reused.
+	tokenCacheRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "token_cache_requests_total",
+		Help:      "Number of ServiceAccount token cache lookups per result (hit or miss).",
+	}, []string{"result"})
+
+	// ztsThrottledRequestsTotal counts the requests requeued because their
+	// issuer was at one of its ZTS limits.
+	ztsThrottledRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "zts_throttled_requests_total",
+		Help:      "Number of requests requeued per issuer and limit (concurrency or rate).",
+	}, []string{"issuer", "limit"})
+
+	// ztsCircuitBreakerOpen is 1 while the circuit breaker of a ZTS endpoint
+	// is open.
+	ztsCircuitBreakerOpen = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "zts_circuit_breaker_open",
+		Help:      "Whether the circuit breaker of a ZTS endpoint is open (1) or closed (0).",
+	}, []string{"endpoint"})
+)
+
+// trustDomainLabel returns the trust domain label of a request. Only trust
+// domains listed by the issuer become label values, the trust domain of a
+// request comes from the request and would let requests add label values
+// without bound.
+func trustDomainLabel(trustDomain string, allowed []string) string {
+	for _, td := range allowed {
+		if strings.EqualFold(td, trustDomain) {
+			return strings.ToLower(td)
+		}
+	}
+	return otherTrustDomain
+}
+
+func init() {
+	metrics.Registry.MustRegister(
+		spiffeRequestsTotal,
+		tokenCacheRequestsTotal,
+		ztsThrottledRequestsTotal,
+		ztsCircuitBreakerOpen,
+	)
+}
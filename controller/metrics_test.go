@@ -0,0 +1,38 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import "testing"
+
+func TestTrustDomainLabel(t *testing.T) {
+	testCases := []struct {
+		trustDomain string
+		allowed     []string
+		expected    string
+	}{
+		{trustDomain: "cluster.local", allowed: []string{"Cluster.Local"}, expected: "cluster.local"},
+		{trustDomain: "evil.example", allowed: []string{"cluster.local"}, expected: otherTrustDomain},
+		// without a list every trust domain is allowed but none is a label
+		{trustDomain: "cluster.local", expected: otherTrustDomain},
+	}
+
+	for _, tc := range testCases {
+		if label := trustDomainLabel(tc.trustDomain, tc.allowed); label != tc.expected {
+			t.Errorf("Expected label %s for trust domain %s, but got %s", tc.expected, tc.trustDomain, label)
+		}
+	}
+}
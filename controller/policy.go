@@ -0,0 +1,157 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	apiutil "github.com/cert-manager/cert-manager/pkg/api/util"
+
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+)
+
+// subjectFieldOIDs names the attribute types of the subject fields a policy
+// can allow.
+var subjectFieldOIDs = map[string]athenzissuerapi.SubjectField{
+	asn1.ObjectIdentifier{2, 5, 4, 3}.String():  "CommonName",
+	asn1.ObjectIdentifier{2, 5, 4, 5}.String():  "SerialNumber",
+	asn1.ObjectIdentifier{2, 5, 4, 6}.String():  "Country",
+	asn1.ObjectIdentifier{2, 5, 4, 7}.String():  "Locality",
+	asn1.ObjectIdentifier{2, 5, 4, 8}.String():  "Province",
+	asn1.ObjectIdentifier{2, 5, 4, 9}.String():  "StreetAddress",
+	asn1.ObjectIdentifier{2, 5, 4, 10}.String(): "Organization",
+	asn1.ObjectIdentifier{2, 5, 4, 11}.String(): "OrganizationalUnit",
+	asn1.ObjectIdentifier{2, 5, 4, 17}.String(): "PostalCode",
+}
+
+// checkCertificatePolicy evaluates the policy of an issuer against the
+// certificate template of a request. Every violation is listed in the
+// returned error.
+func checkCertificatePolicy(policy *athenzissuerapi.CertificatePolicy, template *x509.Certificate) error {
+	var violations []string
+
+	if template.IsCA {
+		violations = append(violations, "CA certificates are not allowed")
+	}
+
+	if len(policy.KeyAlgorithms) > 0 {
+		if err := checkKeyAlgorithm(policy.KeyAlgorithms, template.PublicKey); err != nil {
+			violations = append(violations, err.Error())
+		}
+	}
+
+	if len(policy.AllowedUsages) > 0 {
+		usages := slices.Concat(apiutil.KeyUsageStrings(template.KeyUsage), apiutil.ExtKeyUsageStrings(template.ExtKeyUsage))
+		for _, usage := range usages {
+			if !slices.Contains(policy.AllowedUsages, string(usage)) {
+				violations = append(violations, fmt.Sprintf("usage %q is not allowed", usage))
+			}
+		}
+		if len(template.UnknownExtKeyUsage) > 0 {
+			violations = append(violations, fmt.Sprintf("extended key usages %v are not allowed", template.UnknownExtKeyUsage))
+		}
+	}
+
+	if policy.MaxSANs != nil {
+		sans := len(template.DNSNames) + len(template.IPAddresses) + len(template.URIs) + len(template.EmailAddresses)
+		if sans > int(*policy.MaxSANs) {
+			violations = append(violations, fmt.Sprintf("%d SANs requested, at most %d are allowed", sans, *policy.MaxSANs))
+		}
+	}
+
+	if len(policy.AllowedSubjectFields) > 0 {
+		for _, field := range subjectFields(template) {
+			if !slices.Contains(policy.AllowedSubjectFields, field) {
+				violations = append(violations, fmt.Sprintf("subject field %s is not allowed", field))
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("the request violates the policy of the issuer: %s", strings.Join(violations, "; "))
+	}
+	return nil
+}
+
+// checkKeyAlgorithm checks that the public key uses one of the allowed
+// algorithms with at least its minimum size.
+func checkKeyAlgorithm(allowed []athenzissuerapi.KeyAlgorithmPolicy, publicKey any) error {
+	var algorithm string
+	var size int
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		algorithm, size = "RSA", key.N.BitLen()
+	case *ecdsa.PublicKey:
+		algorithm, size = "ECDSA", key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		algorithm, size = "Ed25519", ed25519.PublicKeySize*8
+	default:
+		return fmt.Errorf("key type %T is not allowed", publicKey)
+	}
+
+	for _, policy := range allowed {
+		if policy.Algorithm != algorithm {
+			continue
+		}
+		if size < int(policy.MinSize) {
+			return fmt.Errorf("%s key of %d bits is smaller than the minimum of %d bits", algorithm, size, policy.MinSize)
+		}
+		return nil
+	}
+	return fmt.Errorf("key algorithm %s is not allowed", algorithm)
+}
+
+// subjectFields returns the fields set in the subject of a template. Attribute
+// types without a field are returned as their OID.
+func subjectFields(template *x509.Certificate) []athenzissuerapi.SubjectField {
+	subject := template.Subject
+	set := map[athenzissuerapi.SubjectField]bool{
+		"CommonName":         subject.CommonName != "",
+		"SerialNumber":       subject.SerialNumber != "",
+		"Country":            len(subject.Country) > 0,
+		"Locality":           len(subject.Locality) > 0,
+		"Province":           len(subject.Province) > 0,
+		"StreetAddress":      len(subject.StreetAddress) > 0,
+		"Organization":       len(subject.Organization) > 0,
+		"OrganizationalUnit": len(subject.OrganizationalUnit) > 0,
+		"PostalCode":         len(subject.PostalCode) > 0,
+	}
+	for _, attr := range slices.Concat(subject.Names, subject.ExtraNames) {
+		field, ok := subjectFieldOIDs[attr.Type.String()]
+		if !ok {
+			field = athenzissuerapi.SubjectField(attr.Type.String())
+		}
+		set[field] = true
+	}
+
+	var fields []athenzissuerapi.SubjectField
+	for field, ok := range set {
+		if ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i] < fields[j] })
+	return fields
+}
@@ -0,0 +1,134 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+
+	"k8s.io/utils/ptr"
+
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+)
+
+func TestCheckCertificatePolicy(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := &athenzissuerapi.CertificatePolicy{
+		KeyAlgorithms: []athenzissuerapi.KeyAlgorithmPolicy{
+			{Algorithm: "ECDSA", MinSize: 256},
+			{Algorithm: "RSA", MinSize: 2048},
+		},
+		AllowedUsages:        []string{"digital signature", "key encipherment", "server auth", "client auth"},
+		MaxSANs:              ptr.To[int32](2),
+		AllowedSubjectFields: []athenzissuerapi.SubjectField{"CommonName", "Organization"},
+	}
+
+	testCases := []struct {
+		name        string
+		policy      *athenzissuerapi.CertificatePolicy
+		template    x509.Certificate
+		expectError bool
+	}{
+		{
+			name:   "conforming request",
+			policy: policy,
+			template: x509.Certificate{
+				PublicKey:   &ecKey.PublicKey,
+				Subject:     pkix.Name{CommonName: "athenz.prod.api", Organization: []string{"Athenz"}},
+				KeyUsage:    x509.KeyUsageDigitalSignature,
+				ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+				DNSNames:    []string{"api.prod.athenz.cloud"},
+			},
+		},
+		{
+			name:        "empty policy still rejects CA requests",
+			policy:      &athenzissuerapi.CertificatePolicy{},
+			template:    x509.Certificate{PublicKey: &ecKey.PublicKey, IsCA: true},
+			expectError: true,
+		},
+		{
+			name:     "empty policy allows everything else",
+			policy:   &athenzissuerapi.CertificatePolicy{},
+			template: x509.Certificate{PublicKey: edKey, Subject: pkix.Name{Country: []string{"US"}}},
+		},
+		{
+			name:        "RSA key below the minimum size",
+			policy:      policy,
+			template:    x509.Certificate{PublicKey: &rsaKey.PublicKey},
+			expectError: true,
+		},
+		{
+			name:        "key algorithm not listed",
+			policy:      policy,
+			template:    x509.Certificate{PublicKey: edKey},
+			expectError: true,
+		},
+		{
+			name:        "usage not allowed",
+			policy:      policy,
+			template:    x509.Certificate{PublicKey: &ecKey.PublicKey, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}},
+			expectError: true,
+		},
+		{
+			name:   "too many SANs",
+			policy: policy,
+			template: x509.Certificate{
+				PublicKey:   &ecKey.PublicKey,
+				DNSNames:    []string{"api.prod.athenz.cloud"},
+				IPAddresses: []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")},
+			},
+			expectError: true,
+		},
+		{
+			name:        "subject field not allowed",
+			policy:      policy,
+			template:    x509.Certificate{PublicKey: &ecKey.PublicKey, Subject: pkix.Name{CommonName: "api", Locality: []string{"Tokyo"}}},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkCertificatePolicy(tc.policy, &tc.template)
+			if tc.expectError && err == nil {
+				t.Errorf("Expected a policy violation")
+			}
+			if !tc.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,405 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+)
+
+const (
+	attestationModeServiceAccountToken = "ServiceAccountToken"
+	attestationModeProviderJWT         = "ProviderJWT"
+
+	defaultProviderJWTLifetime = 5 * time.Minute
+	defaultSigningKeySecretKey = "tls.key"
+
+	// providerKeyReloadInterval is how often every replica reloads the
+	// signing keys served in the JWKS.
+	providerKeyReloadInterval = time.Minute
+)
+
+// attestationMode returns the configured attestation mode, defaulting to
+// ServiceAccount tokens.
+func attestationMode(attestation *athenzissuerapi.Attestation) string {
+	if attestation == nil || attestation.Mode == "" {
+		return attestationModeServiceAccountToken
+	}
+	return attestation.Mode
+}
+
+// providerJWTClaims are the claims of the JWT signed in ProviderJWT mode. The
+// cluster and workload details are shared with the ServiceAccount token
+// attestation data, the identity token itself is never set.
+type providerJWTClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	Audience  string `json:"aud"`
+	IssuedAt  int64  `json:"iat"`
+	NotBefore int64  `json:"nbf"`
+	Expiry    int64  `json:"exp"`
+	ID        string `json:"jti"`
+
+	Namespace      string `json:"namespace"`
+	ServiceAccount string `json:"serviceAccount"`
+	PublicKeyHash  string `json:"publicKeyHash"` //base64url encoded SHA-256 of the CSR public key
+	K8SAttestationData
+}
+
+// newProviderJWTClaims returns the claims for a JWT valid from now for the
+// configured lifetime.
+func newProviderJWTClaims(config *athenzissuerapi.ProviderJWT, provider, namespace, serviceAccount string, publicKey any, data *K8SAttestationData, now time.Time) (*providerJWTClaims, error) {
+	spki, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the CSR public key: %w", err)
+	}
+	hash := sha256.Sum256(spki)
+
+	audience := config.Audience
+	if audience == "" {
+		audience = provider
+	}
+	lifetime := defaultProviderJWTLifetime
+	if config.Lifetime != nil {
+		lifetime = config.Lifetime.Duration
+	}
+
+	return &providerJWTClaims{
+		Issuer:             config.Issuer,
+		Subject:            fmt.Sprintf("system:serviceaccount:%s:%s", namespace, serviceAccount),
+		Audience:           audience,
+		IssuedAt:           now.Unix(),
+		NotBefore:          now.Unix(),
+		Expiry:             now.Add(lifetime).Unix(),
+		ID:                 uuid.NewString(),
+		Namespace:          namespace,
+		ServiceAccount:     serviceAccount,
+		PublicKeyHash:      base64.RawURLEncoding.EncodeToString(hash[:]),
+		K8SAttestationData: *data,
+	}, nil
+}
+
+// providerSigningKey is a private key loaded from an issuer Secret.
+type providerSigningKey struct {
+	keyID string
+	alg   string
+	key   crypto.Signer
+}
+
+// parseProviderSigningKey parses a PEM encoded PKCS#8, SEC 1 or PKCS#1
+// private key.
+func parseProviderSigningKey(data []byte) (*providerSigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM encoded private key found")
+	}
+
+	var key any
+	var err error
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	k := &providerSigningKey{}
+	switch t := key.(type) {
+	case *ecdsa.PrivateKey:
+		switch t.Curve {
+		case elliptic.P256():
+			k.alg = "ES256"
+		case elliptic.P384():
+			k.alg = "ES384"
+		case elliptic.P521():
+			k.alg = "ES512"
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", t.Curve.Params().Name)
+		}
+		k.key = t
+	case *rsa.PrivateKey:
+		if t.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA keys must be at least 2048 bits, got %d", t.N.BitLen())
+		}
+		k.alg = "RS256"
+		k.key = t
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+
+	thumbprint, err := json.Marshal(k.thumbprintMembers())
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(thumbprint)
+	k.keyID = base64.RawURLEncoding.EncodeToString(sum[:])
+	return k, nil
+}
+
+// thumbprintMembers returns the required members of the public JWK, which
+// encoding/json writes in the lexicographic order RFC 7638 asks for.
+func (k *providerSigningKey) thumbprintMembers() map[string]string {
+	switch pub := k.key.Public().(type) {
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return map[string]string{
+			"kty": "EC",
+			"crv": pub.Curve.Params().Name,
+			"x":   base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size))),
+			"y":   base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size))),
+		}
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	default:
+		return nil
+	}
+}
+
+// jwk returns the public JWK of the key.
+func (k *providerSigningKey) jwk() map[string]string {
+	jwk := k.thumbprintMembers()
+	jwk["kid"] = k.keyID
+	jwk["alg"] = k.alg
+	jwk["use"] = "sig"
+	return jwk
+}
+
+func (k *providerSigningKey) hash() crypto.Hash {
+	switch k.alg {
+	case "ES384":
+		return crypto.SHA384
+	case "ES512":
+		return crypto.SHA512
+	default:
+		return crypto.SHA256
+	}
+}
+
+// sign returns the compact JWS serialization of claims.
+func (k *providerSigningKey) sign(claims any) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": k.alg, "typ": "JWT", "kid": k.keyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	h := k.hash().New()
+	h.Write([]byte(signingInput))
+	digest := h.Sum(nil)
+
+	var signature []byte
+	switch key := k.key.(type) {
+	case *ecdsa.PrivateKey:
+		// JWS wants the fixed size r || s encoding rather than ASN.1
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+		if err != nil {
+			return "", err
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		signature = append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, k.hash(), digest)
+		if err != nil {
+			return "", err
+		}
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// providerKeySet holds the signing keys of the issuers in ProviderJWT mode and
+// serves their public keys as a JWKS. The zero value is ready to use.
+type providerKeySet struct {
+	mu   sync.RWMutex
+	keys map[types.NamespacedName]*providerSigningKey
+}
+
+func (s *providerKeySet) get(issuer types.NamespacedName) *providerSigningKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keys[issuer]
+}
+
+func (s *providerKeySet) set(issuer types.NamespacedName, key *providerSigningKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys == nil {
+		s.keys = make(map[types.NamespacedName]*providerSigningKey)
+	}
+	s.keys[issuer] = key
+}
+
+func (s *providerKeySet) remove(issuer types.NamespacedName) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, issuer)
+}
+
+// retain drops the keys of the issuers that are not in keep.
+func (s *providerKeySet) retain(keep map[types.NamespacedName]bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for issuer := range s.keys {
+		if !keep[issuer] {
+			delete(s.keys, issuer)
+		}
+	}
+}
+
+// ServeHTTP writes the JWKS of all loaded keys. Issuers sharing a key share
+// its entry.
+func (s *providerKeySet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.RLock()
+	seen := make(map[string]bool, len(s.keys))
+	keys := make([]map[string]string, 0, len(s.keys))
+	for _, key := range s.keys {
+		if !seen[key.keyID] {
+			seen[key.keyID] = true
+			keys = append(keys, key.jwk())
+		}
+	}
+	s.mu.RUnlock()
+	slices.SortFunc(keys, func(a, b map[string]string) int {
+		return strings.Compare(a["kid"], b["kid"])
+	})
+
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.Header().Set("Cache-Control", "max-age=60")
+	_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+}
+
+// loadProviderSigningKey reads the signing key of an issuer from its Secret.
+func loadProviderSigningKey(ctx context.Context, reader client.Reader, namespace string, ref athenzissuerapi.SecretKeySelector) (*providerSigningKey, error) {
+	secret, err := getSecret(ctx, reader, namespace, ref.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	key := ref.Key
+	if key == "" {
+		key = defaultSigningKeySecretKey
+	}
+	data, ok := secret.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("secret %s in namespace %s has no key %s", ref.Name, namespace, key)
+	}
+	return parseProviderSigningKey(data)
+}
+
+// providerKeyLoader loads the signing keys of the AthenzClusterIssuers in
+// ProviderJWT mode on every replica. The issuer check only runs on the leader,
+// without it the standby replicas behind the JWKS Service would serve an
+// empty key set.
+type providerKeyLoader struct {
+	signer *Signer
+}
+
+func (l providerKeyLoader) NeedLeaderElection() bool {
+	return false
+}
+
+func (l providerKeyLoader) Start(ctx context.Context) error {
+	logger := ctrl.Log.WithName("provider-keys")
+	ticker := time.NewTicker(providerKeyReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := l.signer.loadProviderKeys(ctx); err != nil {
+			logger.Error(err, "Failed to load the provider signing keys")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// loadProviderKeys loads the signing key of every AthenzClusterIssuer in
+// ProviderJWT mode and drops the keys of the other issuers. The key of an
+// issuer whose Secret cannot be read is kept until the next attempt.
+func (s *Signer) loadProviderKeys(ctx context.Context) error {
+	clusterIssuers := &athenzissuerapi.AthenzClusterIssuerList{}
+	if err := s.kubeClient.List(ctx, clusterIssuers); err != nil {
+		return fmt.Errorf("failed to list cluster issuers: %w", err)
+	}
+
+	var errs []error
+	keep := make(map[types.NamespacedName]bool)
+	for _, issuer := range clusterIssuers.Items {
+		attestation := issuer.Spec.Attestation
+		if attestationMode(attestation) != attestationModeProviderJWT {
+			continue
+		}
+		config := attestation.ProviderJWT
+		if config == nil || config.SigningKeySecretRef.Name == "" || config.Issuer == "" {
+			continue
+		}
+
+		issuerName := types.NamespacedName{Name: issuer.Name}
+		keep[issuerName] = true
+		key, err := loadProviderSigningKey(ctx, s.apiReader, s.ClusterResourceNamespace, config.SigningKeySecretRef)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("issuer %s: %w", issuer.Name, err))
+			continue
+		}
+		s.providerKeys.set(issuerName, key)
+	}
+	s.providerKeys.retain(keep)
+	return errors.Join(errs...)
+}
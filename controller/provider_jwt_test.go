@@ -0,0 +1,296 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+)
+
+func TestProviderSigningKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaDER, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name        string
+		pem         []byte
+		expectedAlg string
+		verify      func(digest, signature []byte) bool
+	}{
+		{
+			name:        "EC private key",
+			pem:         pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}),
+			expectedAlg: "ES256",
+			verify: func(digest, signature []byte) bool {
+				r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+				return len(signature) == 64 && ecdsa.Verify(&ecKey.PublicKey, digest, r, s)
+			},
+		},
+		{
+			name:        "PKCS#8 RSA private key",
+			pem:         pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: rsaDER}),
+			expectedAlg: "RS256",
+			verify: func(digest, signature []byte) bool {
+				return rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, digest, signature) == nil
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			key, err := parseProviderSigningKey(tc.pem)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if key.alg != tc.expectedAlg {
+				t.Errorf("Expected alg %s, but got %s", tc.expectedAlg, key.alg)
+			}
+
+			jwt, err := key.sign(map[string]string{"sub": "test"})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			parts := strings.Split(jwt, ".")
+			if len(parts) != 3 {
+				t.Fatalf("Expected a compact JWS, got %s", jwt)
+			}
+
+			var header map[string]string
+			raw, _ := base64.RawURLEncoding.DecodeString(parts[0])
+			if err := json.Unmarshal(raw, &header); err != nil {
+				t.Fatalf("Unexpected header: %v", err)
+			}
+			if header["alg"] != tc.expectedAlg || header["kid"] != key.keyID {
+				t.Errorf("Unexpected header: %v", header)
+			}
+
+			digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+			if !tc.verify(digest[:], signature) {
+				t.Errorf("Signature does not verify")
+			}
+		})
+	}
+
+	if _, err := parseProviderSigningKey([]byte("not a key")); err == nil {
+		t.Errorf("Expected an error for a malformed key")
+	}
+}
+
+func TestProviderJWTClaims(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	config := &athenzissuerapi.ProviderJWT{Issuer: "https://issuer.example"}
+
+	claims, err := newProviderJWTClaims(config, "athenz.k8s.aws-us-west-2", "sandbox", "api", &key.PublicKey, &K8SAttestationData{PodName: "api-0"}, now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	spki, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	hash := sha256.Sum256(spki)
+	if claims.PublicKeyHash != base64.RawURLEncoding.EncodeToString(hash[:]) {
+		t.Errorf("Unexpected public key hash %s", claims.PublicKeyHash)
+	}
+	if claims.Audience != "athenz.k8s.aws-us-west-2" {
+		t.Errorf("Expected the audience to default to the provider, got %s", claims.Audience)
+	}
+	if claims.Expiry-claims.IssuedAt != int64(defaultProviderJWTLifetime.Seconds()) {
+		t.Errorf("Unexpected lifetime of %ds", claims.Expiry-claims.IssuedAt)
+	}
+	if claims.Subject != "system:serviceaccount:sandbox:api" {
+		t.Errorf("Unexpected subject %s", claims.Subject)
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(payload), `"podName":"api-0"`) || strings.Contains(string(payload), "identityToken") {
+		t.Errorf("Unexpected payload %s", payload)
+	}
+}
+
+func TestProviderKeySetJWKS(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(ecKey)
+	key, err := parseProviderSigningKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := &providerKeySet{}
+	keys.set(types.NamespacedName{Name: "issuer"}, key)
+	keys.set(types.NamespacedName{Name: "cluster-issuer"}, key)
+
+	rec := httptest.NewRecorder()
+	keys.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jwks.json", nil))
+	var jwks struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &jwks); err != nil {
+		t.Fatalf("Unexpected JWKS: %v", err)
+	}
+	if len(jwks.Keys) != 1 {
+		t.Fatalf("Expected a shared key to be published once, got %d keys", len(jwks.Keys))
+	}
+	if jwks.Keys[0]["kid"] != key.keyID || jwks.Keys[0]["crv"] != "P-256" {
+		t.Errorf("Unexpected JWK %v", jwks.Keys[0])
+	}
+
+	keys.remove(types.NamespacedName{Name: "issuer"})
+	keys.remove(types.NamespacedName{Name: "cluster-issuer"})
+	rec = httptest.NewRecorder()
+	keys.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jwks.json", nil))
+	if strings.TrimSpace(rec.Body.String()) != `{"keys":[]}` {
+		t.Errorf("Expected an empty JWKS, got %s", rec.Body.String())
+	}
+}
+
+func TestProviderJWTOnlyForClusterIssuers(t *testing.T) {
+	issuer := &athenzissuerapi.AthenzIssuer{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "tenant", Name: "athenz"},
+		Spec: athenzissuerapi.AthenzCertificateSource{
+			ZTSEndpoint: "https://zts.example/zts/v1",
+			Cloud:       "local",
+			Attestation: &athenzissuerapi.Attestation{
+				Mode:        attestationModeProviderJWT,
+				ProviderJWT: &athenzissuerapi.ProviderJWT{SigningKeySecretRef: athenzissuerapi.SecretKeySelector{Name: "signing-key"}, Issuer: "https://issuer.example"},
+			},
+		},
+	}
+	s := &Signer{}
+	_, _, err := s.check(context.Background(), issuer)
+	if !errors.As(err, &signer.PermanentError{}) {
+		t.Errorf("Expected a permanent error for a namespaced issuer in ProviderJWT mode, got %v", err)
+	}
+	if s.providerKeys.get(types.NamespacedName{Namespace: "tenant", Name: "athenz"}) != nil {
+		t.Errorf("Expected the key of a namespaced issuer not to be published")
+	}
+}
+
+func TestLoadProviderKeys(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(ecKey)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := athenzissuerapi.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	newClusterIssuer := func(name string, attestation *athenzissuerapi.Attestation) *athenzissuerapi.AthenzClusterIssuer {
+		issuer := &athenzissuerapi.AthenzClusterIssuer{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		issuer.Spec.Attestation = attestation
+		return issuer
+	}
+	providerJWT := func(secret string) *athenzissuerapi.Attestation {
+		return &athenzissuerapi.Attestation{
+			Mode:        attestationModeProviderJWT,
+			ProviderJWT: &athenzissuerapi.ProviderJWT{SigningKeySecretRef: athenzissuerapi.SecretKeySelector{Name: secret}, Issuer: "https://issuer.example"},
+		}
+	}
+
+	s := &Signer{
+		ClusterResourceNamespace: "athenz-issuer",
+		kubeClient: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			newClusterIssuer("jwt", providerJWT("signing-key")),
+			newClusterIssuer("missing-secret", providerJWT("missing")),
+			newClusterIssuer("token", nil),
+		).Build(),
+		apiReader: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "athenz-issuer", Name: "signing-key"}, Data: map[string][]byte{"tls.key": keyPEM}},
+		).Build(),
+	}
+	// keys of issuers that are gone or no longer in ProviderJWT mode are dropped
+	stale, err := parseProviderSigningKey(keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.providerKeys.set(types.NamespacedName{Name: "token"}, stale)
+	s.providerKeys.set(types.NamespacedName{Name: "deleted"}, stale)
+
+	if err := s.loadProviderKeys(context.Background()); err == nil {
+		t.Errorf("Expected an error for the issuer whose secret is missing")
+	}
+
+	testCases := []struct {
+		issuer   string
+		expected bool
+	}{
+		{issuer: "jwt", expected: true},
+		{issuer: "missing-secret", expected: false},
+		{issuer: "token", expected: false},
+		{issuer: "deleted", expected: false},
+	}
+	for _, tc := range testCases {
+		if loaded := s.providerKeys.get(types.NamespacedName{Name: tc.issuer}) != nil; loaded != tc.expected {
+			t.Errorf("Expected key loaded=%v for issuer %s, but got %v", tc.expected, tc.issuer, loaded)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"sync"
+
+	"github.com/AthenZ/athenz/clients/go/zts"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	issuerutil "github.com/AthenZ/athenz-issuer/internal"
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+	"github.com/cert-manager/issuer-lib/api/v1alpha1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+)
+
+const attestationModeInstanceRegisterToken = "InstanceRegisterToken"
+
+// providerClientSet holds authenticated ZTS clients by issuer, e.g. the
+// clients authenticated as the Athenz provider of the issuers in
+// InstanceRegisterToken mode. The zero value is ready to use.
+type providerClientSet struct {
+	mu      sync.RWMutex
+	clients map[types.NamespacedName]*zts.ZTSClient
+}
+
+func (s *providerClientSet) get(issuer types.NamespacedName) *zts.ZTSClient {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clients[issuer]
+}
+
+func (s *providerClientSet) set(issuer types.NamespacedName, client *zts.ZTSClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.clients == nil {
+		s.clients = make(map[types.NamespacedName]*zts.ZTSClient)
+	}
+	closeIdleConnections(s.clients[issuer])
+	s.clients[issuer] = client
+}
+
+func (s *providerClientSet) remove(issuer types.NamespacedName) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	closeIdleConnections(s.clients[issuer])
+	delete(s.clients, issuer)
+}
+
+// closeIdleConnections releases the pooled connections of a replaced client.
+func closeIdleConnections(client *zts.ZTSClient) {
+	if client == nil {
+		return
+	}
+	if tr, ok := client.Transport.(interface{ CloseIdleConnections() }); ok {
+		tr.CloseIdleConnections()
+	}
+}
+
+// newProviderZTSClient returns a ZTS client that authenticates with the
+// certificate in the given kubernetes.io/tls Secret, e.g. the one of the
+// provider.
+func newProviderZTSClient(ctx context.Context, reader client.Reader, endpoint string, transport *athenzissuerapi.ZTSTransport, namespace, secretName string) (*zts.ZTSClient, error) {
+	secret, err := getSecret(ctx, reader, namespace, secretName)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, signer.PermanentError{Err: fmt.Errorf("secret %s in namespace %s does not hold a valid certificate: %w", secretName, namespace, err)}
+	}
+
+	tr, err := newZTSTransport(transport, &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		return nil, signer.PermanentError{Err: fmt.Errorf("invalid transport: %w", err)}
+	}
+	client := zts.NewClient(endpoint, tr)
+	client.AddCredentials("User-Agent", "athenz-issuer")
+	return &client, nil
+}
+
+// instanceRegisterToken fetches an instance register token for the instance
+// ID the CSR requests from ZTS. The ServiceAccount is looked up, and the
+// requester authorized against it, just like in ServiceAccount token mode.
+func (s *Signer) instanceRegisterToken(ctx context.Context, issuerObject v1alpha1.Issuer, spec *athenzissuerapi.AthenzCertificateSource, identity *issuerutil.SpiffeIdentity, requester *authenticationv1.UserInfo, provider, instanceID string) (string, error) {
+	client := s.providerClients.get(types.NamespacedName{Namespace: issuerObject.GetNamespace(), Name: issuerObject.GetName()})
+	if client == nil {
+		return "", signer.IssuerError{Err: fmt.Errorf("the provider credentials of the issuer are not loaded")}
+	}
+
+	if _, err := s.getServiceAccount(ctx, identity.Namespace, identity.ServiceAccount, spec.RequesterAuthorization, requester); err != nil {
+		return "", err
+	}
+
+	ztsClient, cancel := ztsClientWithContext(ctx, *client, spec.RequestTimeout)
+	defer cancel()
+	return fetchInstanceRegisterToken(ztsClient, provider, identity.Domain, identity.Service, instanceID)
+}
+
+// fetchInstanceRegisterToken returns the attestation data of the instance
+// register token ZTS mints for the instance of domain.service.
+func fetchInstanceRegisterToken(client zts.ZTSClient, provider, domain, service, instanceID string) (string, error) {
+	token, err := client.GetInstanceRegisterToken(zts.ServiceName(provider), zts.DomainName(domain), zts.SimpleName(service), zts.PathElement(instanceID))
+	if err != nil {
+		return "", fmt.Errorf("failed to get instance register token for %s.%s: %w", domain, service, err)
+	}
+	if token == nil || token.AttestationData == "" {
+		return "", fmt.Errorf("ZTS returned an empty instance register token for %s.%s", domain, service)
+	}
+	return token.AttestationData, nil
+}
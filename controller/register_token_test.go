@@ -0,0 +1,69 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AthenZ/athenz/clients/go/zts"
+)
+
+func TestFetchInstanceRegisterToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/instance/athenz.k8s.aws-us-west-2/athenz.prod/api/instance-1/token":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprint(w, `{"provider":"athenz.k8s.aws-us-west-2","domain":"athenz.prod","service":"api","attestationData":"register-token"}`)
+		case "/instance/athenz.k8s.aws-us-west-2/athenz.prod/empty/instance-1/token":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprint(w, `{"provider":"athenz.k8s.aws-us-west-2","domain":"athenz.prod","service":"empty"}`)
+		default:
+			http.Error(w, `{"code":403,"message":"forbidden"}`, http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+	client := zts.NewClient(server.URL, nil)
+
+	testCases := []struct {
+		service       string
+		expectedToken string
+		expectError   bool
+	}{
+		{service: "api", expectedToken: "register-token"},
+		{service: "empty", expectError: true},
+		{service: "denied", expectError: true},
+	}
+
+	for _, tc := range testCases {
+		token, err := fetchInstanceRegisterToken(client, "athenz.k8s.aws-us-west-2", "athenz.prod", tc.service, "instance-1")
+		if tc.expectError {
+			if err == nil {
+				t.Errorf("Expected an error for service %s", tc.service)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for service %s: %v", tc.service, err)
+		}
+		if token != tc.expectedToken {
+			t.Errorf("Expected token %s, but got %s", tc.expectedToken, token)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+)
+
+const (
+	// signResultTTL is how long an issued certificate is kept for retries
+	// of its request, well beyond the retry window of issuer-lib.
+	signResultTTL = 10 * time.Minute
+
+	// maxSignResultEntries bounds the cache, expired entries are dropped
+	// once it is reached.
+	maxSignResultEntries = 1024
+)
+
+type signResultEntry struct {
+	csrHash [sha256.Size]byte
+	bundle  signer.PEMBundle
+	expires time.Time
+}
+
+// signResultCache remembers the certificates issued per request, so that a
+// Sign retried after the status update failed returns the certificate ZTS
+// already issued instead of registering the instance a second time. Entries
+// are evicted once their request completes. The zero value is ready to use.
+type signResultCache struct {
+	mu      sync.Mutex
+	entries map[types.UID]signResultEntry
+	now     func() time.Time
+}
+
+func (c *signResultCache) get(uid types.UID, csr []byte) (signer.PEMBundle, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[uid]
+	if !ok || entry.csrHash != sha256.Sum256(csr) || !c.clock().Before(entry.expires) {
+		return signer.PEMBundle{}, false
+	}
+	return entry.bundle, true
+}
+
+func (c *signResultCache) set(uid types.UID, csr []byte, bundle signer.PEMBundle) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock()
+	if c.entries == nil {
+		c.entries = make(map[types.UID]signResultEntry)
+	}
+	if len(c.entries) >= maxSignResultEntries {
+		for uid, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, uid)
+			}
+		}
+	}
+	if _, ok := c.entries[uid]; ok || len(c.entries) < maxSignResultEntries {
+		c.entries[uid] = signResultEntry{csrHash: sha256.Sum256(csr), bundle: bundle, expires: now.Add(signResultTTL)}
+	}
+}
+
+func (c *signResultCache) evict(uid types.UID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, uid)
+}
+
+func (c *signResultCache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// evictionHandler evicts the entry of a request once it has its certificate,
+// has failed or is deleted.
+func (c *signResultCache) evictionHandler() toolscache.ResourceEventHandler {
+	return toolscache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(_, obj interface{}) {
+			if uid, done := requestCompleted(obj); done {
+				c.evict(uid)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			switch t := obj.(type) {
+			case *cmapi.CertificateRequest:
+				c.evict(t.UID)
+			case *certificatesv1.CertificateSigningRequest:
+				c.evict(t.UID)
+			}
+		},
+	}
+}
+
+// requestCompleted reports whether a CertificateRequest or
+// CertificateSigningRequest will not be signed again.
+func requestCompleted(obj interface{}) (types.UID, bool) {
+	switch t := obj.(type) {
+	case *cmapi.CertificateRequest:
+		if len(t.Status.Certificate) > 0 {
+			return t.UID, true
+		}
+		for _, cond := range t.Status.Conditions {
+			if cond.Type == cmapi.CertificateRequestConditionReady && cond.Status == cmmeta.ConditionFalse &&
+				(cond.Reason == cmapi.CertificateRequestReasonFailed || cond.Reason == cmapi.CertificateRequestReasonDenied) {
+				return t.UID, true
+			}
+		}
+	case *certificatesv1.CertificateSigningRequest:
+		if len(t.Status.Certificate) > 0 {
+			return t.UID, true
+		}
+		for _, cond := range t.Status.Conditions {
+			if (cond.Type == certificatesv1.CertificateFailed || cond.Type == certificatesv1.CertificateDenied) && cond.Status == corev1.ConditionTrue {
+				return t.UID, true
+			}
+		}
+	}
+	return "", false
+}
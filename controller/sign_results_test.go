@@ -0,0 +1,92 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+)
+
+func TestSignResultCache(t *testing.T) {
+	now := time.Now()
+	cache := &signResultCache{now: func() time.Time { return now }}
+	bundle := signer.PEMBundle{ChainPEM: []byte("chain")}
+	cache.set("uid-1", []byte("csr"), bundle)
+
+	if got, ok := cache.get("uid-1", []byte("csr")); !ok || string(got.ChainPEM) != "chain" {
+		t.Errorf("Expected the cached bundle to be returned")
+	}
+	if _, ok := cache.get("uid-1", []byte("other csr")); ok {
+		t.Errorf("Expected a different CSR not to match")
+	}
+	if _, ok := cache.get("uid-2", []byte("csr")); ok {
+		t.Errorf("Expected a different request not to match")
+	}
+
+	now = now.Add(signResultTTL)
+	if _, ok := cache.get("uid-1", []byte("csr")); ok {
+		t.Errorf("Expected the entry to expire")
+	}
+}
+
+func TestSignResultCacheEviction(t *testing.T) {
+	cache := &signResultCache{}
+	handler := cache.evictionHandler()
+
+	pending := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{UID: "cr"}}
+	issued := pending.DeepCopy()
+	issued.Status.Certificate = []byte("chain")
+	failed := &certificatesv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{UID: "csr"},
+		Status: certificatesv1.CertificateSigningRequestStatus{
+			Conditions: []certificatesv1.CertificateSigningRequestCondition{{Type: certificatesv1.CertificateFailed, Status: corev1.ConditionTrue}},
+		},
+	}
+	denied := &cmapi.CertificateRequest{
+		ObjectMeta: metav1.ObjectMeta{UID: "denied"},
+		Status: cmapi.CertificateRequestStatus{
+			Conditions: []cmapi.CertificateRequestCondition{{Type: cmapi.CertificateRequestConditionReady, Status: cmmeta.ConditionFalse, Reason: cmapi.CertificateRequestReasonDenied}},
+		},
+	}
+
+	for _, uid := range []string{"cr", "csr", "denied", "deleted"} {
+		cache.set(types.UID(uid), []byte("csr"), signer.PEMBundle{ChainPEM: []byte("chain")})
+	}
+
+	handler.OnUpdate(pending, pending)
+	if _, ok := cache.get("cr", []byte("csr")); !ok {
+		t.Errorf("Expected a pending request to keep its entry")
+	}
+	handler.OnUpdate(pending, issued)
+	handler.OnUpdate(failed, failed)
+	handler.OnUpdate(denied, denied)
+	handler.OnDelete(toolscache.DeletedFinalStateUnknown{Obj: &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{UID: "deleted"}}})
+
+	if len(cache.entries) != 0 {
+		t.Errorf("Expected completed requests to be evicted, %d entries left", len(cache.entries))
+	}
+}
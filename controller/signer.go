@@ -21,21 +21,34 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"math/big"
 	"net/http"
+	"strings"
 	"time"
 
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	authenticationv1 "k8s.io/api/authentication/v1"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	issuerutil "github.com/AthenZ/athenz-issuer/internal"
 	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
@@ -57,21 +70,100 @@ import (
 
 // +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
-// +kubebuilder:rbac:groups=core,resources=serviceaccounts;serviceaccounts/token,verbs=create;get
+// +kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=serviceaccounts/token,verbs=create
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get
+
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
 
 type Signer struct {
-	ztsEndpoint    string
-	ztsClient      zts.ZTSClient
-	cloud          string
-	region         string
-	providerPrefix string
+	// ClusterResourceNamespace is the namespace Secrets referenced by
+	// AthenzClusterIssuers are read from.
+	ClusterResourceNamespace string
+
+	// CheckInterval is how often every issuer is checked again, 0 disables
+	// the periodic checks.
+	CheckInterval time.Duration
+
+	// kubeClient reads from the informer cache of the manager, apiReader
+	// and clientset talk to the API server directly.
+	kubeClient client.Client
+	apiReader  client.Reader
+	clientset  kubernetes.Interface
+
+	eventRecorder record.EventRecorder
+	elected       <-chan struct{}
+
+	// recheck feeds the issuer controllers, by issuer kind
+	recheck map[string]chan event.GenericEvent
+
+	launchAuthorizations launchAuthorizationCache
+	providerKeys         providerKeySet
+	providerClients      providerClientSet
+	credentialClients    providerClientSet
+	serviceAccountTokens serviceAccountTokenCache
+	signResults          signResultCache
+	ztsTransports        ztsTransportSet
+	ztsLimits            ztsLimiterSet
+	ztsBreakers          circuitBreakerSet
+	ztsEndpointPools     ztsEndpointPoolSet
+	issuerHealth         issuerHealthSet
+}
+
+// JWKSHandler serves the public keys of the issuers in ProviderJWT
+// attestation mode.
+func (s *Signer) JWKSHandler() http.Handler {
+	return &s.providerKeys
 }
 
 type K8SAttestationData struct {
 	IdentityToken string `json:"identityToken,omitempty"` //the service account token obtained from the api server
+
+	// The following are only set when the issuer opts into attestation context
+	InstanceID  string `json:"instanceId,omitempty"`  //stable id derived from the cluster and workload
+	ClusterName string `json:"clusterName,omitempty"` //name of the cluster the workload runs in
+	RequestUID  string `json:"requestUID,omitempty"`  //uid of the CertificateRequest being signed
+	PodName     string `json:"podName,omitempty"`
+	PodUID      string `json:"podUID,omitempty"`
+	NodeName    string `json:"nodeName,omitempty"`
 }
 
-func (s Signer) SetupWithManager(ctx context.Context, mgr ctrl.Manager) error {
+func (s *Signer) SetupWithManager(ctx context.Context, mgr ctrl.Manager) error {
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return fmt.Errorf("failed to create clientset: %w", err)
+	}
+	s.clientset = clientset
+	s.kubeClient = mgr.GetClient()
+	s.apiReader = mgr.GetAPIReader()
+	s.eventRecorder = mgr.GetEventRecorderFor("athenzissuer.cert-manager.athenz.io")
+	s.elected = mgr.Elected()
+	s.recheck = make(map[string]chan event.GenericEvent)
+
+	if err := mgr.Add(providerKeyLoader{signer: s}); err != nil {
+		return fmt.Errorf("failed to add the provider key loader: %w", err)
+	}
+	if err := mgr.Add(manager.RunnableFunc(s.probeZTSEndpoints)); err != nil {
+		return fmt.Errorf("failed to add the ZTS endpoint prober: %w", err)
+	}
+	if s.CheckInterval > 0 {
+		if err := mgr.Add(manager.RunnableFunc(s.recheckIssuers)); err != nil {
+			return fmt.Errorf("failed to add the issuer recheck: %w", err)
+		}
+	}
+
+	for _, obj := range []client.Object{&cmapi.CertificateRequest{}, &certificatesv1.CertificateSigningRequest{}} {
+		informer, err := mgr.GetCache().GetInformer(ctx, obj)
+		if err != nil {
+			return fmt.Errorf("failed to get informer for %T: %w", obj, err)
+		}
+		if _, err := informer.AddEventHandler(s.signResults.evictionHandler()); err != nil {
+			return fmt.Errorf("failed to watch %T: %w", obj, err)
+		}
+	}
+
 	return (&controllers.CombinedController{
 		IssuerTypes:        []v1alpha1.Issuer{&athenzissuerapi.AthenzIssuer{}},
 		ClusterIssuerTypes: []v1alpha1.Issuer{&athenzissuerapi.AthenzClusterIssuer{}},
@@ -81,38 +173,145 @@ func (s Signer) SetupWithManager(ctx context.Context, mgr ctrl.Manager) error {
 
 		Sign:          s.Sign,
 		Check:         s.Check,
-		EventRecorder: mgr.GetEventRecorderFor("athenzissuer.cert-manager.athenz.io"),
+		EventRecorder: s.eventRecorder,
+
+		// istio-csr reads the root from the CA field of the request, it is
+		// only filled in for issuers in istio-csr mode.
+		SetCAOnCertificateRequest: true,
+
+		PreSetupWithManager: func(ctx context.Context, gvk schema.GroupVersionKind, mgr ctrl.Manager, b *builder.Builder) error {
+			ch := make(chan event.GenericEvent)
+			s.recheck[gvk.Kind] = ch
+			b.WatchesRawSource(source.Channel(ch, &handler.EnqueueRequestForObject{}))
+			return nil
+		},
 	}).SetupWithManager(ctx, mgr)
 }
 
+// Check checks the issuer and records the outcome in the issuer status: on
+// success whether issued chains are verified and, when ZTS was called, the
+// time and latency of the call and whether it was authenticated.
 func (s *Signer) Check(ctx context.Context, issuerObject v1alpha1.Issuer) error {
-	switch t := issuerObject.(type) {
-	case *athenzissuerapi.AthenzIssuer:
-		s.ztsEndpoint = t.Spec.ZTSEndpoint
-		s.region = t.Spec.Region
-		s.cloud = t.Spec.Cloud
-		s.providerPrefix = t.Spec.ProviderPrefix
-	case *athenzissuerapi.AthenzClusterIssuer:
-		s.ztsEndpoint = t.Spec.ZTSEndpoint
-		s.region = t.Spec.Region
-		s.cloud = t.Spec.Cloud
-		s.providerPrefix = t.Spec.ProviderPrefix
-	default:
-		return fmt.Errorf("not an issuer type: %t", t)
+	latency, authenticated, err := s.check(ctx, issuerObject)
+	s.issuerHealth.set(types.NamespacedName{Namespace: issuerObject.GetNamespace(), Name: issuerObject.GetName()}, err == nil)
+	if err == nil && s.kubeClient != nil {
+		spec, _ := issuerSpec(issuerObject)
+		status := map[string]any{
+			"chainVerified": len(spec.CABundle) > 0,
+		}
+		if latency > 0 {
+			status["lastReachableTime"] = metav1.Now()
+			status["checkLatency"] = metav1.Duration{Duration: latency.Round(time.Millisecond)}
+			status["checkAuthenticated"] = authenticated
+		}
+		if err := s.applyIssuerStatus(ctx, issuerObject, issuerCheckFieldOwner, status); err != nil {
+			ctrl.LoggerFrom(ctx).Error(err, "Failed to record the check in the issuer status")
+		}
+	}
+	return err
+}
+
+// check validates the issuer, loads its credentials and calls ZTS. It returns
+// how long the call took and whether it was made with the issuer credentials.
+func (s *Signer) check(ctx context.Context, issuerObject v1alpha1.Issuer) (time.Duration, bool, error) {
+	spec, err := issuerSpec(issuerObject)
+	if err != nil {
+		return 0, false, err
+	}
+	if t, ok := issuerObject.(*athenzissuerapi.AthenzClusterIssuer); ok && t.Spec.NamespaceSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(t.Spec.NamespaceSelector); err != nil {
+			return 0, false, signer.PermanentError{Err: fmt.Errorf("invalid namespace selector: %w", err)}
+		}
+	}
+	if err := issuerutil.ValidateAthenzNamePatterns(spec.AllowedDomains); err != nil {
+		return 0, false, signer.PermanentError{Err: fmt.Errorf("invalid allowedDomains: %w", err)}
+	}
+	if err := issuerutil.ValidateAthenzNamePatterns(spec.DeniedServices); err != nil {
+		return 0, false, signer.PermanentError{Err: fmt.Errorf("invalid deniedServices: %w", err)}
+	}
+	if len(spec.CABundle) > 0 {
+		roots, err := issuerutil.ParseCertificatesPEM(spec.CABundle)
+		if err == nil && len(roots) == 0 {
+			err = fmt.Errorf("no PEM certificates found")
+		}
+		if err != nil {
+			return 0, false, signer.PermanentError{Err: fmt.Errorf("invalid caBundle: %w", err)}
+		}
+	}
+	if err := checkTokenSource(issuerObject, spec); err != nil {
+		return 0, false, err
 	}
+	endpoints := ztsEndpoints(spec)
+	if len(endpoints) == 0 {
+		return 0, false, signer.PermanentError{Err: fmt.Errorf("one of ztsEndpoint or ztsEndpoints is required")}
+	}
+
 	// create zts client
-	tr := &http.Transport{
-		TLSClientConfig:   &tls.Config{},
-		Proxy:             http.ProxyFromEnvironment,
-		DisableKeepAlives: true,
+	tr, err := s.ztsTransports.get(types.NamespacedName{Namespace: issuerObject.GetNamespace(), Name: issuerObject.GetName()}, spec.Transport)
+	if err != nil {
+		return 0, false, signer.PermanentError{Err: fmt.Errorf("invalid transport: %w", err)}
+	}
+	pool, err := s.ztsEndpointPools.get(ctx, issuerObject, endpoints, &s.ztsBreakers, tr)
+	if err != nil {
+		return 0, false, err
+	}
+	if err := s.loadCredentials(ctx, issuerObject, spec, pool); err != nil {
+		return 0, false, err
+	}
+	if spec.LaunchAuthorization != nil && s.credentialClient(types.NamespacedName{Namespace: issuerObject.GetNamespace(), Name: issuerObject.GetName()}) == nil {
+		return 0, false, signer.PermanentError{Err: fmt.Errorf("launchAuthorization requires credentialsSecretRef or InstanceRegisterToken attestation, ZTS only answers access checks of authenticated callers")}
 	}
 
-	s.ztsClient = zts.NewClient(s.ztsEndpoint, tr)
-	s.ztsClient.AddCredentials("User-Agent", "athenz-issuer")
-	return nil
+	if spec.Cloud == "local" {
+		// certificates are issued locally
+		return 0, false, nil
+	}
+
+	// a lightweight call, ZTS authenticates the caller of /status. Made with
+	// the issuer credentials it proves ZTS accepts them. Issuers without
+	// credentials have nothing to authenticate with, the call then only
+	// proves ZTS can be reached and its certificate verified, and ZTS
+	// turning it away is expected. While ZTS is considered down the issuer
+	// stays not ready, every check probes it once a circuit breaker lets a
+	// call through.
+	checkClient, authenticated := newIssuerZTSClient(pool, tr), false
+	if credentialClient := s.credentialClient(types.NamespacedName{Namespace: issuerObject.GetNamespace(), Name: issuerObject.GetName()}); credentialClient != nil {
+		checkClient, authenticated = *credentialClient, true
+	}
+	client, cancel := ztsClientWithContext(ctx, checkClient, spec.RequestTimeout)
+	defer cancel()
+	start := time.Now()
+	if _, err := client.GetStatus(); err != nil && (authenticated || !ztsAnswered(err)) {
+		return 0, false, fmt.Errorf("ZTS %s is unavailable: %w", strings.Join(pool.urls(), ", "), err)
+	}
+	return time.Since(start), authenticated, nil
 }
 
+// Sign returns the certificate issued by an earlier call for the same request
+// when there is one, so a retry after a failed status update does not
+// register the instance with ZTS again.
 func (s *Signer) Sign(ctx context.Context, cr signer.CertificateRequestObject, issuerObject v1alpha1.Issuer) (signer.PEMBundle, error) {
+	_, _, csrBytes, err := cr.GetRequest()
+	if err != nil {
+		return signer.PEMBundle{}, err
+	}
+	if bundle, ok := s.signResults.get(cr.GetUID(), csrBytes); ok {
+		ctrl.LoggerFrom(ctx).Info("Returning the certificate issued by an earlier attempt")
+		return bundle, nil
+	}
+
+	bundle, err := s.sign(ctx, cr, issuerObject)
+	if err == nil && len(bundle.ChainPEM) > 0 {
+		s.signResults.set(cr.GetUID(), csrBytes, bundle)
+	}
+	return bundle, err
+}
+
+func (s *Signer) sign(ctx context.Context, cr signer.CertificateRequestObject, issuerObject v1alpha1.Issuer) (signer.PEMBundle, error) {
+	spec, err := issuerSpec(issuerObject)
+	if err != nil {
+		return signer.PEMBundle{}, err
+	}
 
 	// load client certificate request
 	clientCRTTemplate, _, csrBytes, err := cr.GetRequest()
@@ -120,32 +319,134 @@ func (s *Signer) Sign(ctx context.Context, cr signer.CertificateRequestObject, i
 		return signer.PEMBundle{}, err
 	}
 
-	// Get the service account name from cr
-	spiffeURI, err := issuerutil.ExtractSpiffeURIFromAnnotations(cr.GetAnnotations())
+	if spec.Policy != nil {
+		if err := checkCertificatePolicy(spec.Policy, clientCRTTemplate); err != nil {
+			return signer.PEMBundle{}, s.rejectRequest(cr, "PolicyViolation", err)
+		}
+	}
+
+	// Get the workload identity from cr
+	spiffeIdentity, workload, err := resolveIdentity(ctx, cr, csrBytes, spec)
 	if err != nil {
-		fmt.Printf("Unable to extract spiffe uri from annotations, err: %v\n", err)
-		spiffeURI, err = issuerutil.ExtractSpiffeURIFromCSR(csrBytes)
+		return signer.PEMBundle{}, err
 	}
 
-	fmt.Printf("spiffeURI=%s\n", spiffeURI)
-	spiffeNS, spiffeSA, err := issuerutil.ExtractNamespaceAndServiceAccountFromSpiffeURI(spiffeURI)
+	if err := checkIssuerMayAttestNamespace(ctx, s.kubeClient, issuerObject, spiffeIdentity.Namespace); err != nil {
+		return signer.PEMBundle{}, err
+	}
+
+	logger := ctrl.LoggerFrom(ctx).WithValues("trustDomain", spiffeIdentity.TrustDomain)
+	trustDomain := trustDomainLabel(spiffeIdentity.TrustDomain, spec.AllowedTrustDomains)
+	if !issuerutil.IsTrustDomainAllowed(spiffeIdentity.TrustDomain, spec.AllowedTrustDomains) {
+		spiffeRequestsTotal.WithLabelValues(trustDomain, "denied").Inc()
+		logger.Info("Rejecting request for a trust domain that is not allowed", "allowedTrustDomains", spec.AllowedTrustDomains)
+		return signer.PEMBundle{}, signer.PermanentError{Err: fmt.Errorf("trust domain %q is not allowed by this issuer", spiffeIdentity.TrustDomain)}
+	}
+	spiffeRequestsTotal.WithLabelValues(trustDomain, "allowed").Inc()
+	ctx = ctrl.LoggerInto(ctx, logger)
 
-	// use the token in zts api call
-	saTok, err := getServiceAccountTokenFromAPIServer(spiffeNS, ctx, spiffeSA, s)
+	athenzDomain, athenzService := spiffeIdentity.Domain, spiffeIdentity.Service
+	if len(spec.AllowedDomains) > 0 && !issuerutil.MatchAthenzNamePatterns(athenzDomain, spec.AllowedDomains) {
+		return signer.PEMBundle{}, s.rejectRequest(cr, "DomainNotAllowed", fmt.Errorf("athenz domain %q is not allowed by this issuer", athenzDomain))
+	}
+	if issuerutil.MatchAthenzNamePatterns(athenzDomain+"."+athenzService, spec.DeniedServices) {
+		return signer.PEMBundle{}, s.rejectRequest(cr, "ServiceDenied", fmt.Errorf("athenz service %s.%s is denied by this issuer", athenzDomain, athenzService))
+	}
+	if config := spec.CSRValidation; config != nil {
+		policy := issuerutil.AthenzSANPolicy{DNSSuffixes: config.DNSSuffixes, AllowIPAddresses: config.AllowIPAddresses, AllowWildcards: config.AllowWildcards}
+		if err := issuerutil.ValidateAthenzCSR(clientCRTTemplate, athenzDomain, athenzService, policy); err != nil {
+			return signer.PEMBundle{}, s.rejectRequest(cr, "CSRNotConformant", err)
+		}
+	}
+
+	// the client is built for the endpoints loaded by the last check of
+	// this issuer, issuers never share a client
+	ztsClient, pool, err := s.issuerZTSClient(issuerObject)
 	if err != nil {
 		return signer.PEMBundle{}, err
 	}
 
-	athenzDomain, athenzService := issuerutil.ExtractDomainServiceFromServiceAccount(spiffeSA)
-	athenzProvider := fmt.Sprintf("%s.%s-%s", s.providerPrefix, s.cloud, s.region)
+	var requester *authenticationv1.UserInfo
+	if spec.RequesterAuthorization != nil {
+		requester, err = requesterFromRequest(cr)
+		if err != nil {
+			return signer.PEMBundle{}, err
+		}
+	}
+
+	// everything from here on may talk to ZTS, the launch authorization
+	// check included
+	issuerName := types.NamespacedName{Namespace: issuerObject.GetNamespace(), Name: issuerObject.GetName()}
+	release, err := s.ztsLimits.acquire(issuerName, spec.MaxConcurrentRequests, spec.RequestsPerSecond)
+	if err != nil {
+		return signer.PEMBundle{}, err
+	}
+	defer release()
 
-	data, err := json.Marshal(&K8SAttestationData{
-		IdentityToken: string(saTok),
-	})
+	if spec.LaunchAuthorization != nil {
+		credentialClient := s.credentialClient(issuerName)
+		if credentialClient == nil {
+			return signer.PEMBundle{}, signer.IssuerError{Err: fmt.Errorf("the credentials of the issuer are not loaded")}
+		}
+		client, cancel := ztsClientWithContext(ctx, *credentialClient, spec.RequestTimeout)
+		granted, principal, err := s.launchAuthorizations.checkLaunchAuthorization(client, issuerName, spec.LaunchAuthorization, spiffeIdentity.Namespace, athenzDomain, athenzService)
+		cancel()
+		if err != nil {
+			return signer.PEMBundle{}, s.ztsError(issuerObject, err)
+		}
+		if !granted {
+			return signer.PEMBundle{}, s.rejectRequest(cr, "LaunchNotAuthorized", fmt.Errorf("athenz denied %s to launch %s.%s", principal, athenzDomain, athenzService))
+		}
+	}
+
+	athenzProvider := fmt.Sprintf("%s.%s-%s", spec.ProviderPrefix, spec.Cloud, spec.Region)
+
+	attestationData := &K8SAttestationData{}
+	if spec.AttestationContext != nil {
+		if err := addAttestationContext(ctx, s.apiReader, attestationData, spec.AttestationContext, cr, spiffeIdentity, workload); err != nil {
+			return signer.PEMBundle{}, err
+		}
+	}
+
+	var data []byte
+	switch attestationMode(spec.Attestation) {
+	case attestationModeProviderJWT:
+		jwt, err := s.providerJWT(ctx, issuerObject, spec, spiffeIdentity, workload, requester, clientCRTTemplate.PublicKey, athenzProvider, attestationData)
+		if err != nil {
+			return signer.PEMBundle{}, err
+		}
+		data = []byte(jwt)
+	case attestationModeInstanceRegisterToken:
+		// the token is bound to the instance ID, it has to be the one the
+		// certificate is requested for
+		instanceID, err := issuerutil.ExtractAthenzInstanceID(clientCRTTemplate, athenzProvider)
+		if err != nil {
+			return signer.PEMBundle{}, s.rejectRequest(cr, "InstanceIDMissing", err)
+		}
+		token, err := s.instanceRegisterToken(ctx, issuerObject, spec, spiffeIdentity, requester, athenzProvider, instanceID)
+		if err != nil {
+			return signer.PEMBundle{}, s.ztsError(issuerObject, err)
+		}
+		data = []byte(token)
+	default:
+		if err := checkTokenSource(issuerObject, spec); err != nil {
+			return signer.PEMBundle{}, err
+		}
+		// use the token in zts api call
+		saTok, err := s.serviceAccountToken(ctx, spec, pool.primary(), spiffeIdentity, workloadPod(workload, attestationData), requester)
+		if err != nil {
+			return signer.PEMBundle{}, err
+		}
+		attestationData.IdentityToken = saTok
+		data, err = json.Marshal(attestationData)
+		if err != nil {
+			return signer.PEMBundle{}, err
+		}
+	}
 
 	fmt.Printf("athenzDomain=%s athenzService=%s athenzProvider=%s\n", athenzDomain, athenzService, athenzProvider)
 
-	if s.cloud == "local" {
+	if spec.Cloud == "local" {
 		// generate random ca private key
 		caPrivateKey, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
 		if err != nil {
@@ -177,62 +478,276 @@ func (s *Signer) Sign(ctx context.Context, cr signer.CertificateRequestObject, i
 			ChainPEM: clientCrt,
 		}, nil
 	} else {
-		identity, _, err := s.ztsClient.PostInstanceRegisterInformation(&zts.InstanceRegisterInformation{
+		client, cancel := ztsClientWithContext(ctx, ztsClient, spec.RequestTimeout)
+		defer cancel()
+		identity, _, err := client.PostInstanceRegisterInformation(&zts.InstanceRegisterInformation{
 			Domain:          zts.DomainName(athenzDomain),
 			Service:         zts.SimpleName(athenzService),
 			Provider:        zts.ServiceName(athenzProvider),
 			AttestationData: string(data),
 			Csr:             string(csrBytes),
-			Cloud:           zts.SimpleName(s.cloud),
-			Namespace:       zts.SimpleName(spiffeNS),
+			Cloud:           zts.SimpleName(spec.Cloud),
+			Namespace:       zts.SimpleName(spiffeIdentity.Namespace),
 		})
 		if err != nil {
 			fmt.Printf("Unable to do PostInstanceRegisterInformation, err: %v\n", err)
-			return signer.PEMBundle{}, err
+			return signer.PEMBundle{}, s.ztsError(issuerObject, err)
+		}
+
+		if identity == nil {
+			return signer.PEMBundle{}, fmt.Errorf("ZTS returned no identity for %s.%s", athenzDomain, athenzService)
+		}
+		// without a caBundle the chain is not verified, which the issuer
+		// status reports rather than every request
+		if _, err := verifyIssuedCertificate([]byte(identity.X509Certificate), spec.CABundle, clientCRTTemplate.PublicKey, spiffeIdentity, time.Now()); err != nil {
+			return signer.PEMBundle{}, s.rejectRequest(cr, "InvalidCertificate", fmt.Errorf("ZTS returned an invalid certificate: %w", err))
+		}
+		if spec.IstioCSR != nil {
+			return istioCSRBundle([]byte(identity.X509Certificate), []byte(identity.X509CertificateSigner))
 		}
+		return signer.PEMBundle{
+			ChainPEM: []byte(identity.X509Certificate),
+		}, nil
+	}
+}
+
+// issuerZTSClient returns a ZTS client for the endpoint pool and transport
+// the last check of the issuer loaded.
+func (s *Signer) issuerZTSClient(issuerObject v1alpha1.Issuer) (zts.ZTSClient, *ztsEndpointPool, error) {
+	issuerName := types.NamespacedName{Namespace: issuerObject.GetNamespace(), Name: issuerObject.GetName()}
+	pool := s.ztsEndpointPools.lookup(issuerName)
+	tr := s.ztsTransports.lookup(issuerName)
+	if pool == nil || tr == nil {
+		return zts.ZTSClient{}, nil, signer.IssuerError{Err: fmt.Errorf("the ZTS endpoints of the issuer are not loaded")}
+	}
+	return newIssuerZTSClient(pool, tr), pool, nil
+}
+
+// newIssuerZTSClient returns a ZTS client that sends its requests to the
+// active endpoint of pool through tr.
+func newIssuerZTSClient(pool *ztsEndpointPool, tr http.RoundTripper) zts.ZTSClient {
+	client := zts.NewClient(pool.primary(), pool.transport(tr))
+	client.AddCredentials("User-Agent", "athenz-issuer")
+	return client
+}
 
-		if identity != nil {
-			return signer.PEMBundle{
-				ChainPEM: []byte(identity.X509Certificate),
-			}, nil
-		} else {
-			fmt.Println("identity is nil")
-			return signer.PEMBundle{}, nil
+// ztsError turns the errors of ZTS calls made while the circuit breakers of
+// all endpoints of the issuer are open into issuer errors. The issuer is then
+// marked not ready and its requests wait for it, instead of each of them
+// burning its retries against a ZTS that is down.
+func (s *Signer) ztsError(issuerObject v1alpha1.Issuer, err error) error {
+	var open *circuitOpenError
+	if errors.As(err, &open) {
+		return signer.IssuerError{Err: open}
+	}
+	pool := s.ztsEndpointPools.lookup(types.NamespacedName{Namespace: issuerObject.GetNamespace(), Name: issuerObject.GetName()})
+	if pool != nil && pool.unavailable() {
+		// this call tripped the last circuit breaker
+		if s.eventRecorder != nil {
+			s.eventRecorder.Eventf(issuerObject, corev1.EventTypeWarning, "ZTSCircuitOpen", "Stopped sending requests to %s after %d consecutive failures: %v", strings.Join(pool.urls(), ", "), circuitBreakerThreshold, err)
 		}
+		return signer.IssuerError{Err: fmt.Errorf("ZTSUnavailable: %w", err)}
+	}
+	return err
+}
+
+// rejectRequest records a warning Event on the request and returns err as a
+// permanent error.
+func (s *Signer) rejectRequest(cr signer.CertificateRequestObject, reason string, err error) error {
+	s.requestEvent(cr, corev1.EventTypeWarning, reason, err.Error())
+	return signer.PermanentError{Err: err}
+}
+
+// requestEvent records an Event on the request.
+func (s *Signer) requestEvent(cr signer.CertificateRequestObject, eventType, reason, message string) {
+	if obj, ok := cr.(runtime.Object); ok && s.eventRecorder != nil {
+		s.eventRecorder.Event(obj, eventType, reason, message)
 	}
 }
 
-func getServiceAccountTokenFromAPIServer(namespaceName string, ctx context.Context, spiffeSA string, signerObj *Signer) (string, error) {
-	config, err := rest.InClusterConfig()
+// loadCredentials loads the signing key of an issuer in ProviderJWT
+// attestation mode, or its ZTS provider client in InstanceRegisterToken mode,
+// and forgets them once the issuer uses another mode. It also loads the ZTS
+// client authenticated with the credentials of the issuer, when it has them.
+func (s *Signer) loadCredentials(ctx context.Context, issuerObject v1alpha1.Issuer, spec *athenzissuerapi.AthenzCertificateSource, pool *ztsEndpointPool) error {
+	issuerName := types.NamespacedName{Namespace: issuerObject.GetNamespace(), Name: issuerObject.GetName()}
+	namespace := issuerObject.GetNamespace()
+	if namespace == "" {
+		namespace = s.ClusterResourceNamespace
+	}
+
+	if ref := spec.CredentialsSecretRef; ref != nil {
+		client, err := newProviderZTSClient(ctx, s.apiReader, pool.primary(), spec.Transport, namespace, ref.Name)
+		if err != nil {
+			return err
+		}
+		client.Transport = pool.transport(client.Transport)
+		s.credentialClients.set(issuerName, client)
+	} else {
+		s.credentialClients.remove(issuerName)
+	}
+
+	mode := attestationMode(spec.Attestation)
+	if mode != attestationModeProviderJWT {
+		s.providerKeys.remove(issuerName)
+	}
+	if mode != attestationModeInstanceRegisterToken {
+		s.providerClients.remove(issuerName)
+	}
+
+	switch mode {
+	case attestationModeProviderJWT:
+		if issuerObject.GetNamespace() != "" {
+			// the JWKS the provider trusts is shared by all issuers, a
+			// namespace tenant must not be able to add their key to it
+			return signer.PermanentError{Err: fmt.Errorf("attestation mode %s is only available to AthenzClusterIssuers", mode)}
+		}
+		config := spec.Attestation.ProviderJWT
+		if config == nil || config.SigningKeySecretRef.Name == "" || config.Issuer == "" {
+			return signer.PermanentError{Err: fmt.Errorf("attestation mode %s requires providerJWT with a signing key secret and an issuer", mode)}
+		}
+		key, err := loadProviderSigningKey(ctx, s.apiReader, namespace, config.SigningKeySecretRef)
+		if err != nil {
+			return err
+		}
+		s.providerKeys.set(issuerName, key)
+	case attestationModeInstanceRegisterToken:
+		config := spec.Attestation.InstanceRegisterToken
+		if config == nil || config.ProviderCredentialsSecretRef.Name == "" {
+			return signer.PermanentError{Err: fmt.Errorf("attestation mode %s requires instanceRegisterToken with a provider credentials secret", mode)}
+		}
+		client, err := newProviderZTSClient(ctx, s.apiReader, pool.primary(), spec.Transport, namespace, config.ProviderCredentialsSecretRef.Name)
+		if err != nil {
+			return err
+		}
+		client.Transport = pool.transport(client.Transport)
+		s.providerClients.set(issuerName, client)
+	}
+	return nil
+}
+
+// credentialClient returns the ZTS client an issuer authenticates its own
+// calls with, the one of its credentials or else the provider client. It is
+// nil when the issuer has neither.
+func (s *Signer) credentialClient(issuer types.NamespacedName) *zts.ZTSClient {
+	if client := s.credentialClients.get(issuer); client != nil {
+		return client
+	}
+	return s.providerClients.get(issuer)
+}
+
+// providerJWT signs the attestation JWT for a workload with the key of the
+// issuer. The ServiceAccount is looked up, and the requester authorized
+// against it, just like in ServiceAccount token mode.
+func (s *Signer) providerJWT(ctx context.Context, issuerObject v1alpha1.Issuer, spec *athenzissuerapi.AthenzCertificateSource, identity *issuerutil.SpiffeIdentity, workload issuerutil.WorkloadAnnotations, requester *authenticationv1.UserInfo, publicKey any, provider string, data *K8SAttestationData) (string, error) {
+	key := s.providerKeys.get(types.NamespacedName{Namespace: issuerObject.GetNamespace(), Name: issuerObject.GetName()})
+	if key == nil {
+		return "", signer.IssuerError{Err: fmt.Errorf("the signing key of the issuer is not loaded")}
+	}
+
+	sa, err := s.getServiceAccount(ctx, identity.Namespace, identity.ServiceAccount, spec.RequesterAuthorization, requester)
 	if err != nil {
-		return "", fmt.Errorf("failed to get in cluster config: %w", err)
+		return "", err
 	}
 
-	clientset, err := kubernetes.NewForConfig(config)
+	if spec.AttestationContext == nil {
+		// with an attestation context only the pod details it confirmed
+		// are attested
+		data.PodName = workload.PodName
+		data.PodUID = workload.PodUID
+	}
+	claims, err := newProviderJWTClaims(spec.Attestation.ProviderJWT, provider, identity.Namespace, sa.Name, publicKey, data, time.Now())
 	if err != nil {
-		return "", fmt.Errorf("failed to get clientset: %w", err)
+		return "", signer.PermanentError{Err: err}
+	}
+	return key.sign(claims)
+}
+
+// issuerSpec returns the AthenzCertificateSource of the given issuer object.
+func issuerSpec(issuerObject v1alpha1.Issuer) (*athenzissuerapi.AthenzCertificateSource, error) {
+	switch t := issuerObject.(type) {
+	case *athenzissuerapi.AthenzIssuer:
+		return &t.Spec, nil
+	case *athenzissuerapi.AthenzClusterIssuer:
+		return &t.Spec.AthenzCertificateSource, nil
+	default:
+		return nil, fmt.Errorf("not an issuer type: %t", t)
 	}
+}
 
-	sa, err := clientset.CoreV1().ServiceAccounts(namespaceName).Get(ctx, spiffeSA, metav1.GetOptions{})
+// getSecret reads a Secret. Secrets are read from the API server rather than
+// a cache so the controller does not keep every Secret of the cluster in
+// memory.
+func getSecret(ctx context.Context, reader client.Reader, namespace, name string) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	if err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret); err != nil {
+		return nil, fmt.Errorf("failed to get secret %s in namespace %s: %w", name, namespace, err)
+	}
+	return secret, nil
+}
+
+// tokenRequestOptions tunes the tokens minted by the API server.
+type tokenRequestOptions struct {
+	// cacheRefreshPercent of the token lifetime after which a cached token is
+	// replaced, 0 disables the cache
+	cacheRefreshPercent int32
+	// boundPod, when set, binds the token to the pod
+	boundPod *authenticationv1.BoundObjectReference
+	// audience of the token, the primary ZTS endpoint of the issuer
+	audience string
+}
+
+func getServiceAccountTokenFromAPIServer(namespaceName string, ctx context.Context, spiffeSA string, signerObj *Signer, authz *athenzissuerapi.RequesterAuthorization, requester *authenticationv1.UserInfo, opts tokenRequestOptions) (string, error) {
+	sa, err := signerObj.getServiceAccount(ctx, namespaceName, spiffeSA, authz, requester)
 	if err != nil {
-		// try with a fallback service account name
-		_, fallbackSA := issuerutil.ExtractDomainServiceFromServiceAccount(spiffeSA)
-		sa, err = clientset.CoreV1().ServiceAccounts(namespaceName).Get(ctx, fallbackSA, metav1.GetOptions{})
-		if err != nil {
-			// if we still can't find the service account, return an error
-			return "", fmt.Errorf("failed to get service account %s or %s in namespace %s: %w", spiffeSA, fallbackSA, namespaceName, err)
+		return "", err
+	}
+
+	// bound tokens are only valid for their pod, they are never shared
+	useCache := opts.cacheRefreshPercent > 0 && opts.boundPod == nil
+	cacheKey := tokenCacheKey(namespaceName, sa.Name, opts.audience)
+	if useCache {
+		if token, ok := signerObj.serviceAccountTokens.get(cacheKey, opts.cacheRefreshPercent); ok {
+			return token, nil
 		}
 	}
 
 	tr := &authenticationv1.TokenRequest{
 		Spec: authenticationv1.TokenRequestSpec{
-			Audiences: []string{signerObj.ztsEndpoint},
+			Audiences:      []string{opts.audience},
+			BoundObjectRef: opts.boundPod,
 		},
 	}
-	tokenReq, err := clientset.CoreV1().ServiceAccounts(namespaceName).CreateToken(ctx, sa.Name, tr, metav1.CreateOptions{})
+	tokenReq, err := signerObj.clientset.CoreV1().ServiceAccounts(namespaceName).CreateToken(ctx, sa.Name, tr, metav1.CreateOptions{})
 	if err != nil {
 		return "", fmt.Errorf("failed to create token request: %w", err)
 	}
 
+	if useCache {
+		signerObj.serviceAccountTokens.set(cacheKey, tokenReq.Status.Token, tokenReq.Status.ExpirationTimestamp.Time)
+	}
 	return tokenReq.Status.Token, nil
 }
+
+// getServiceAccount looks up the ServiceAccount of a workload in the informer
+// cache and, when configured, checks that the requester may use it.
+func (s *Signer) getServiceAccount(ctx context.Context, namespaceName string, spiffeSA string, authz *athenzissuerapi.RequesterAuthorization, requester *authenticationv1.UserInfo) (*corev1.ServiceAccount, error) {
+	sa := &corev1.ServiceAccount{}
+	err := s.kubeClient.Get(ctx, types.NamespacedName{Namespace: namespaceName, Name: spiffeSA}, sa)
+	if err != nil {
+		// try with a fallback service account name
+		_, fallbackSA := issuerutil.ExtractDomainServiceFromServiceAccount(spiffeSA)
+		err = s.kubeClient.Get(ctx, types.NamespacedName{Namespace: namespaceName, Name: fallbackSA}, sa)
+		if err != nil {
+			// if we still can't find the service account, return an error
+			return nil, fmt.Errorf("failed to get service account %s or %s in namespace %s: %w", spiffeSA, fallbackSA, namespaceName, err)
+		}
+	}
+
+	if authz != nil {
+		if err := checkRequesterMayUseServiceAccount(ctx, s.clientset, authz, requester, namespaceName, sa.Name); err != nil {
+			return nil, err
+		}
+	}
+	return sa, nil
+}
@@ -0,0 +1,100 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+)
+
+func TestGetServiceAccount(t *testing.T) {
+	s := &Signer{
+		kubeClient: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "sandbox", Name: "athenz.prod.api"}},
+			&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "sandbox", Name: "web"}},
+		).Build(),
+	}
+
+	testCases := []struct {
+		serviceAccount string
+		expectedName   string
+		expectError    bool
+	}{
+		{serviceAccount: "athenz.prod.api", expectedName: "athenz.prod.api"},
+		// falls back to the service name
+		{serviceAccount: "athenz.prod.web", expectedName: "web"},
+		{serviceAccount: "athenz.prod.db", expectError: true},
+	}
+
+	for _, tc := range testCases {
+		sa, err := s.getServiceAccount(context.Background(), "sandbox", tc.serviceAccount, nil, nil)
+		if tc.expectError {
+			if err == nil {
+				t.Errorf("Expected an error for service account %s", tc.serviceAccount)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for service account %s: %v", tc.serviceAccount, err)
+			continue
+		}
+		if sa.Name != tc.expectedName {
+			t.Errorf("Expected service account %s, but got %s", tc.expectedName, sa.Name)
+		}
+	}
+}
+
+func TestIssuerZTSClient(t *testing.T) {
+	newIssuer := func(namespace, endpoint string) *athenzissuerapi.AthenzIssuer {
+		return &athenzissuerapi.AthenzIssuer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "athenz"},
+			Spec:       athenzissuerapi.AthenzCertificateSource{ZTSEndpoint: endpoint, Cloud: "local"},
+		}
+	}
+	a := newIssuer("team-a", "https://zts-a.example/zts/v1")
+	b := newIssuer("team-b", "https://zts-b.example/zts/v1")
+
+	s := &Signer{}
+	if _, _, err := s.issuerZTSClient(a); !errors.As(err, &signer.IssuerError{}) {
+		t.Errorf("Expected an issuer error before the issuer is checked, got %v", err)
+	}
+
+	// the issuer checked last must not change the client of the other
+	for _, issuer := range []*athenzissuerapi.AthenzIssuer{a, b} {
+		if _, _, err := s.check(context.Background(), issuer); err != nil {
+			t.Fatalf("Unexpected error checking %s: %v", issuer.Namespace, err)
+		}
+	}
+	for _, issuer := range []*athenzissuerapi.AthenzIssuer{a, b} {
+		client, pool, err := s.issuerZTSClient(issuer)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", issuer.Namespace, err)
+		}
+		if client.URL != issuer.Spec.ZTSEndpoint || pool.primary() != issuer.Spec.ZTSEndpoint {
+			t.Errorf("Expected the client of %s to use %s, but got %s", issuer.Namespace, issuer.Spec.ZTSEndpoint, client.URL)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sync"
+	"time"
+)
+
+// maxTokenCacheEntries bounds the cache, expired entries are dropped once it
+// is reached.
+const maxTokenCacheEntries = 4096
+
+type tokenCacheEntry struct {
+	token   string
+	issued  time.Time
+	expires time.Time
+}
+
+// serviceAccountTokenCache reuses minted ServiceAccount tokens for a part of
+// their lifetime, so that renewal storms do not turn into one TokenRequest
+// per request. The zero value is ready to use.
+type serviceAccountTokenCache struct {
+	mu      sync.Mutex
+	entries map[string]tokenCacheEntry
+	now     func() time.Time
+}
+
+func tokenCacheKey(namespace, serviceAccount, audience string) string {
+	return namespace + "/" + serviceAccount + "|" + audience
+}
+
+// get returns the cached token when less than refreshPercent of its lifetime
+// has passed.
+func (c *serviceAccountTokenCache) get(key string, refreshPercent int32) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if ok {
+		lifetime := entry.expires.Sub(entry.issued)
+		refreshAt := entry.issued.Add(lifetime * time.Duration(refreshPercent) / 100)
+		ok = c.clock().Before(refreshAt)
+	}
+	if !ok {
+		tokenCacheRequestsTotal.WithLabelValues("miss").Inc()
+		return "", false
+	}
+	tokenCacheRequestsTotal.WithLabelValues("hit").Inc()
+	return entry.token, true
+}
+
+func (c *serviceAccountTokenCache) set(key, token string, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock()
+	if c.entries == nil {
+		c.entries = make(map[string]tokenCacheEntry)
+	}
+	if len(c.entries) >= maxTokenCacheEntries {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	if _, ok := c.entries[key]; ok || len(c.entries) < maxTokenCacheEntries {
+		c.entries[key] = tokenCacheEntry{token: token, issued: now, expires: expires}
+	}
+}
+
+func (c *serviceAccountTokenCache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
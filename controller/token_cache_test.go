@@ -0,0 +1,67 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestServiceAccountTokenCache(t *testing.T) {
+	now := time.Now()
+	cache := &serviceAccountTokenCache{now: func() time.Time { return now }}
+	key := tokenCacheKey("sandbox", "api", "https://zts.example/zts/v1")
+	hits := testutil.ToFloat64(tokenCacheRequestsTotal.WithLabelValues("hit"))
+
+	if _, ok := cache.get(key, 50); ok {
+		t.Fatalf("Expected an empty cache")
+	}
+	cache.set(key, "token", now.Add(time.Hour))
+
+	testCases := []struct {
+		elapsed  time.Duration
+		percent  int32
+		expected bool
+	}{
+		{elapsed: 0, percent: 50, expected: true},
+		{elapsed: 29 * time.Minute, percent: 50, expected: true},
+		{elapsed: 30 * time.Minute, percent: 50, expected: false},
+		{elapsed: 45 * time.Minute, percent: 80, expected: true},
+		{elapsed: 50 * time.Minute, percent: 80, expected: false},
+	}
+
+	for _, tc := range testCases {
+		now = cache.entries[key].issued.Add(tc.elapsed)
+		token, ok := cache.get(key, tc.percent)
+		if ok != tc.expected {
+			t.Errorf("Expected hit=%v after %s at %d%%, but got %v", tc.expected, tc.elapsed, tc.percent, ok)
+		}
+		if ok && token != "token" {
+			t.Errorf("Unexpected token %s", token)
+		}
+	}
+
+	if got := testutil.ToFloat64(tokenCacheRequestsTotal.WithLabelValues("hit")) - hits; got != 3 {
+		t.Errorf("Expected 3 cache hits to be counted, got %v", got)
+	}
+
+	if _, ok := cache.get(tokenCacheKey("sandbox", "api", "https://other.example"), 50); ok {
+		t.Errorf("Expected tokens not to be shared between audiences")
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	issuerutil "github.com/AthenZ/athenz-issuer/internal"
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+	"github.com/cert-manager/issuer-lib/api/v1alpha1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+)
+
+const (
+	tokenSourceTokenRequest = "TokenRequest"
+	tokenSourceSecret       = "Secret"
+	tokenSourceFile         = "File"
+
+	defaultTokenSecretKey = "token"
+
+	// minTokenValidity is how long a stored token has to remain valid to be
+	// sent to ZTS, leaving time for the registration to complete.
+	minTokenValidity = 30 * time.Second
+)
+
+// serviceAccountToken returns the token of the workload ServiceAccount from
+// the configured source. Tokens minted by the API server are minted for
+// audience.
+func (s *Signer) serviceAccountToken(ctx context.Context, spec *athenzissuerapi.AthenzCertificateSource, audience string, identity *issuerutil.SpiffeIdentity, pod issuerutil.WorkloadAnnotations, requester *authenticationv1.UserInfo) (string, error) {
+	config := &athenzissuerapi.ServiceAccountTokenSource{}
+	if spec.Attestation != nil && spec.Attestation.ServiceAccountToken != nil {
+		config = spec.Attestation.ServiceAccountToken
+	}
+	if config.Source == "" || config.Source == tokenSourceTokenRequest {
+		// tokens are only cached when the issuer opts in
+		opts := tokenRequestOptions{audience: audience}
+		if config.CacheRefreshPercent != nil {
+			opts.cacheRefreshPercent = *config.CacheRefreshPercent
+		}
+		if config.BoundToPod {
+			if pod.PodName == "" || pod.PodUID == "" {
+				return "", signer.PermanentError{Err: fmt.Errorf("tokens are bound to pods but the request does not name its pod and pod uid")}
+			}
+			opts.boundPod = &authenticationv1.BoundObjectReference{Kind: "Pod", APIVersion: "v1", Name: pod.PodName, UID: types.UID(pod.PodUID)}
+		}
+		return getServiceAccountTokenFromAPIServer(identity.Namespace, ctx, identity.ServiceAccount, s, spec.RequesterAuthorization, requester, opts)
+	}
+
+	sa, err := s.getServiceAccount(ctx, identity.Namespace, identity.ServiceAccount, spec.RequesterAuthorization, requester)
+	if err != nil {
+		return "", err
+	}
+
+	var token, origin string
+	switch config.Source {
+	case tokenSourceSecret:
+		if config.SecretRef == nil {
+			return "", signer.PermanentError{Err: fmt.Errorf("token source %s requires a secretRef", tokenSourceSecret)}
+		}
+		token, origin, err = readTokenSecret(ctx, s.apiReader, config.SecretRef, sa)
+	case tokenSourceFile:
+		if config.Path == "" {
+			return "", signer.PermanentError{Err: fmt.Errorf("token source %s requires a path", tokenSourceFile)}
+		}
+		token, origin, err = readTokenFile(config.Path, sa)
+	default:
+		return "", signer.PermanentError{Err: fmt.Errorf("unknown token source %s", config.Source)}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := checkTokenExpiry(token, time.Now()); err != nil {
+		return "", fmt.Errorf("token of service account %s in namespace %s from %s is not usable: %w", sa.Name, sa.Namespace, origin, err)
+	}
+	return token, nil
+}
+
+// checkTokenSource rejects token sources the issuer may not use. Only
+// AthenzClusterIssuers may read tokens from files, the files of the
+// controller, like its own ServiceAccount token, are off limits to namespace
+// tenants.
+func checkTokenSource(issuerObject v1alpha1.Issuer, spec *athenzissuerapi.AthenzCertificateSource) error {
+	if spec.Attestation == nil || spec.Attestation.ServiceAccountToken == nil {
+		return nil
+	}
+	if spec.Attestation.ServiceAccountToken.Source == tokenSourceFile && issuerObject.GetNamespace() != "" {
+		return signer.PermanentError{Err: fmt.Errorf("token source %s is only available to AthenzClusterIssuers", tokenSourceFile)}
+	}
+	return nil
+}
+
+// workloadPod returns the pod of a request, preferring the pod UID confirmed by
+// the attestation context lookup over the one named by the request.
+func workloadPod(workload issuerutil.WorkloadAnnotations, data *K8SAttestationData) issuerutil.WorkloadAnnotations {
+	pod := issuerutil.WorkloadAnnotations{PodName: workload.PodName, PodUID: workload.PodUID}
+	if data.PodUID != "" {
+		pod.PodUID = data.PodUID
+	}
+	return pod
+}
+
+// readTokenSecret reads the token of a ServiceAccount from a Secret in its
+// namespace. A ServiceAccount token Secret has to belong to the ServiceAccount.
+func readTokenSecret(ctx context.Context, reader client.Reader, ref *athenzissuerapi.SecretKeySelector, sa *corev1.ServiceAccount) (string, string, error) {
+	name := strings.ReplaceAll(ref.Name, "{serviceAccount}", sa.Name)
+	origin := fmt.Sprintf("secret %s", name)
+
+	secret, err := getSecret(ctx, reader, sa.Namespace, name)
+	if err != nil {
+		return "", origin, err
+	}
+	if secret.Type == corev1.SecretTypeServiceAccountToken && secret.Annotations[corev1.ServiceAccountNameKey] != sa.Name {
+		return "", origin, signer.PermanentError{Err: fmt.Errorf("%s holds the token of service account %s, not %s", origin, secret.Annotations[corev1.ServiceAccountNameKey], sa.Name)}
+	}
+
+	key := ref.Key
+	if key == "" {
+		key = defaultTokenSecretKey
+	}
+	token := strings.TrimSpace(string(secret.Data[key]))
+	if token == "" {
+		return "", origin, fmt.Errorf("%s in namespace %s has no token in key %s", origin, sa.Namespace, key)
+	}
+	return token, origin, nil
+}
+
+// readTokenFile reads the token of a ServiceAccount from a file.
+func readTokenFile(pathTemplate string, sa *corev1.ServiceAccount) (string, string, error) {
+	path := strings.NewReplacer("{namespace}", sa.Namespace, "{serviceAccount}", sa.Name).Replace(pathTemplate)
+	origin := fmt.Sprintf("file %s", path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", origin, fmt.Errorf("failed to read token file: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", origin, fmt.Errorf("token file %s is empty", path)
+	}
+	return token, origin, nil
+}
+
+// checkTokenExpiry fails for a JWT that expires within minTokenValidity of
+// now. Tokens without an expiry, like legacy ServiceAccount token Secrets, are
+// accepted.
+func checkTokenExpiry(token string, now time.Time) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return fmt.Errorf("failed to decode token payload: %w", err)
+	}
+	var claims struct {
+		Expiry *int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return fmt.Errorf("failed to parse token payload: %w", err)
+	}
+	if claims.Expiry == nil {
+		return nil
+	}
+
+	expiry := time.Unix(*claims.Expiry, 0)
+	if now.Add(minTokenValidity).After(expiry) {
+		return fmt.Errorf("token is stale, it expires at %s", expiry.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
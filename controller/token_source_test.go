@@ -0,0 +1,128 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+	"github.com/cert-manager/issuer-lib/api/v1alpha1"
+)
+
+func TestCheckTokenExpiry(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	jwt := func(payload string) string {
+		return "e30." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".c2ln"
+	}
+
+	testCases := []struct {
+		name        string
+		token       string
+		expectError bool
+	}{
+		{name: "valid for an hour", token: jwt(`{"exp":1700003600}`)},
+		{name: "no expiry", token: jwt(`{"sub":"system:serviceaccount:sandbox:api"}`)},
+		{name: "expired", token: jwt(`{"exp":1699999000}`), expectError: true},
+		{name: "about to expire", token: jwt(`{"exp":1700000010}`), expectError: true},
+		{name: "not a JWT", token: "opaque-token", expectError: true},
+		{name: "malformed payload", token: "e30.!!!.c2ln", expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkTokenExpiry(tc.token, now)
+			if tc.expectError && err == nil {
+				t.Errorf("Expected an error for token %s", tc.token)
+			}
+			if !tc.expectError && err != nil {
+				t.Errorf("Unexpected error for token %s: %v", tc.token, err)
+			}
+		})
+	}
+}
+
+func TestReadTokenFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sandbox", "api"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sandbox", "api", "token"), []byte("header.payload.signature\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "sandbox", Name: "api"}}
+
+	token, origin, err := readTokenFile(filepath.Join(dir, "{namespace}", "{serviceAccount}", "token"), sa)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if token != "header.payload.signature" {
+		t.Errorf("Unexpected token %q from %s", token, origin)
+	}
+
+	if _, _, err := readTokenFile(filepath.Join(dir, "{namespace}", "missing", "token"), sa); err == nil {
+		t.Errorf("Expected an error for a missing token file")
+	}
+}
+
+func TestCheckTokenSource(t *testing.T) {
+	fileSource := athenzissuerapi.AthenzCertificateSource{
+		Attestation: &athenzissuerapi.Attestation{ServiceAccountToken: &athenzissuerapi.ServiceAccountTokenSource{Source: tokenSourceFile, Path: "/var/run/secrets/kubernetes.io/serviceaccount/token"}},
+	}
+	secretSource := athenzissuerapi.AthenzCertificateSource{
+		Attestation: &athenzissuerapi.Attestation{ServiceAccountToken: &athenzissuerapi.ServiceAccountTokenSource{Source: tokenSourceSecret}},
+	}
+
+	testCases := []struct {
+		name        string
+		issuer      v1alpha1.Issuer
+		expectError bool
+	}{
+		{
+			name:        "namespaced issuer reading a file",
+			issuer:      &athenzissuerapi.AthenzIssuer{ObjectMeta: metav1.ObjectMeta{Namespace: "tenant", Name: "athenz"}, Spec: fileSource},
+			expectError: true,
+		},
+		{
+			name:   "namespaced issuer reading a secret",
+			issuer: &athenzissuerapi.AthenzIssuer{ObjectMeta: metav1.ObjectMeta{Namespace: "tenant", Name: "athenz"}, Spec: secretSource},
+		},
+		{
+			name:   "cluster issuer reading a file",
+			issuer: &athenzissuerapi.AthenzClusterIssuer{ObjectMeta: metav1.ObjectMeta{Name: "athenz"}, Spec: athenzissuerapi.AthenzClusterIssuerSpec{AthenzCertificateSource: fileSource}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			spec, _ := issuerSpec(tc.issuer)
+			err := checkTokenSource(tc.issuer, spec)
+			if tc.expectError && err == nil {
+				t.Errorf("Expected the token source to be rejected")
+			}
+			if !tc.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
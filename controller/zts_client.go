@@ -0,0 +1,182 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/AthenZ/athenz/clients/go/zts"
+	"github.com/ardielle/ardielle-go/rdl"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+)
+
+const defaultZTSRequestTimeout = 30 * time.Second
+
+// ztsAnswered reports whether err is an error response of ZTS that says
+// nothing about its health, e.g. a call turned away for lack of credentials.
+func ztsAnswered(err error) bool {
+	var resourceErr rdl.ResourceError
+	return errors.As(err, &resourceErr) && resourceErr.Code < http.StatusInternalServerError
+}
+
+// contextTransport binds every request to a context. The ZTS client builds
+// its requests without one, so this is what lets a cancelled reconcile or a
+// shutting down manager abort calls that are in flight.
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req.WithContext(t.ctx))
+}
+
+// ztsClientWithContext returns a copy of client whose calls are aborted once
+// ctx is done or the request timeout, 30s by default, has passed. The cancel
+// function has to be called once the calls are done.
+func ztsClientWithContext(ctx context.Context, client zts.ZTSClient, requestTimeout *metav1.Duration) (zts.ZTSClient, context.CancelFunc) {
+	timeout := defaultZTSRequestTimeout
+	if requestTimeout != nil && requestTimeout.Duration > 0 {
+		timeout = requestTimeout.Duration
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	client.Transport = &contextTransport{ctx: ctx, base: client.Transport}
+	return client, cancel
+}
+
+const (
+	defaultZTSDialTimeout           = 10 * time.Second
+	defaultZTSTLSHandshakeTimeout   = 10 * time.Second
+	defaultZTSResponseHeaderTimeout = 30 * time.Second
+	defaultZTSIdleConnTimeout       = 90 * time.Second
+	defaultZTSMaxIdleConns          = 16
+)
+
+// newZTSTransport returns a pooled transport configured as in config, which
+// may be nil for the defaults.
+func newZTSTransport(config *athenzissuerapi.ZTSTransport, tlsConfig *tls.Config) (*http.Transport, error) {
+	if config == nil {
+		config = &athenzissuerapi.ZTSTransport{}
+	}
+	duration := func(d *metav1.Duration, def time.Duration) time.Duration {
+		if d != nil {
+			return d.Duration
+		}
+		return def
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if config.ProxyURL != "" {
+		proxyURL, err := url.Parse(config.ProxyURL)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy url %q", config.ProxyURL)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+	maxIdleConns := defaultZTSMaxIdleConns
+	if config.MaxIdleConns != nil {
+		maxIdleConns = int(*config.MaxIdleConns)
+	}
+
+	tr := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   duration(config.DialTimeout, defaultZTSDialTimeout),
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   duration(config.TLSHandshakeTimeout, defaultZTSTLSHandshakeTimeout),
+		ResponseHeaderTimeout: duration(config.ResponseHeaderTimeout, defaultZTSResponseHeaderTimeout),
+		IdleConnTimeout:       duration(config.IdleConnTimeout, defaultZTSIdleConnTimeout),
+		MaxIdleConns:          maxIdleConns,
+		MaxIdleConnsPerHost:   maxIdleConns,
+		ForceAttemptHTTP2:     !config.DisableHTTP2,
+	}
+	if config.DisableHTTP2 {
+		// a non-nil empty map turns HTTP/2 off
+		tr.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return tr, nil
+}
+
+type ztsTransportEntry struct {
+	config    string
+	transport *http.Transport
+}
+
+// ztsTransportSet keeps one pooled transport per issuer, so that connections
+// survive re-checks of the issuer as long as its transport settings do not
+// change. The zero value is ready to use.
+type ztsTransportSet struct {
+	mu      sync.Mutex
+	entries map[types.NamespacedName]ztsTransportEntry
+}
+
+// get returns the transport of an issuer, replacing it when the settings
+// changed.
+func (s *ztsTransportSet) get(issuer types.NamespacedName, config *athenzissuerapi.ZTSTransport) (*http.Transport, error) {
+	key, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[issuer]
+	if ok && entry.config == string(key) {
+		return entry.transport, nil
+	}
+	tr, err := newZTSTransport(config, &tls.Config{})
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		entry.transport.CloseIdleConnections()
+	}
+	if s.entries == nil {
+		s.entries = make(map[types.NamespacedName]ztsTransportEntry)
+	}
+	s.entries[issuer] = ztsTransportEntry{config: string(key), transport: tr}
+	return tr, nil
+}
+
+// lookup returns the transport of an issuer, nil when it has none yet.
+func (s *ztsTransportSet) lookup(issuer types.NamespacedName) *http.Transport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok := s.entries[issuer]; ok {
+		return entry.transport
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AthenZ/athenz/clients/go/zts"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+)
+
+func TestZTSClientWithContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// hang until the client gives up or the test ends
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	t.Run("request timeout", func(t *testing.T) {
+		client, cancel := ztsClientWithContext(context.Background(), zts.NewClient(server.URL, nil), &metav1.Duration{Duration: 50 * time.Millisecond})
+		defer cancel()
+
+		start := time.Now()
+		_, err := client.GetResourceAccessExt("launch", "athenz.prod:service.api", "", "athenz.k8s.sandbox")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected the call to time out, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("Expected the call to be aborted promptly, took %s", elapsed)
+		}
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		ctx, cancelCtx := context.WithCancel(context.Background())
+		client, cancel := ztsClientWithContext(ctx, zts.NewClient(server.URL, nil), nil)
+		defer cancel()
+
+		time.AfterFunc(50*time.Millisecond, cancelCtx)
+		_, err := client.GetResourceAccessExt("launch", "athenz.prod:service.api", "", "athenz.k8s.sandbox")
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected the call to be cancelled, got %v", err)
+		}
+	})
+}
+
+func TestZTSTransportSet(t *testing.T) {
+	transports := &ztsTransportSet{}
+	issuer := types.NamespacedName{Namespace: "sandbox", Name: "issuer"}
+
+	first, err := transports.get(issuer, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if first.DisableKeepAlives || first.MaxIdleConnsPerHost != defaultZTSMaxIdleConns || first.ResponseHeaderTimeout != defaultZTSResponseHeaderTimeout {
+		t.Errorf("Unexpected default transport settings")
+	}
+	if again, _ := transports.get(issuer, nil); again != first {
+		t.Errorf("Expected the transport to be reused while the settings are unchanged")
+	}
+
+	config := &athenzissuerapi.ZTSTransport{ProxyURL: "http://proxy.example:3128", DisableHTTP2: true}
+	changed, err := transports.get(issuer, config)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if changed == first {
+		t.Errorf("Expected a new transport once the settings change")
+	}
+	if changed.ForceAttemptHTTP2 || changed.TLSNextProto == nil {
+		t.Errorf("Expected HTTP/2 to be disabled")
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://zts.example/zts/v1", nil)
+	if proxy, err := changed.Proxy(req); err != nil || proxy.String() != "http://proxy.example:3128" {
+		t.Errorf("Expected the configured proxy, got %v", proxy)
+	}
+
+	if _, err := transports.get(types.NamespacedName{Name: "other"}, &athenzissuerapi.ZTSTransport{ProxyURL: "not a url"}); err == nil {
+		t.Errorf("Expected an error for an invalid proxy url")
+	}
+}
+
+// BenchmarkZTSTransport compares the pooled transport with the former one
+// that opened a new TLS connection for every call, against a local ZTS
+// stand-in.
+func BenchmarkZTSTransport(b *testing.B) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"granted":true}`)
+	}))
+	defer server.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	pooled, err := newZTSTransport(nil, &tls.Config{RootCAs: roots})
+	if err != nil {
+		b.Fatal(err)
+	}
+	transports := map[string]*http.Transport{
+		"pooled": pooled,
+		"no keep-alives": {
+			TLSClientConfig:   &tls.Config{RootCAs: roots},
+			Proxy:             http.ProxyFromEnvironment,
+			DisableKeepAlives: true,
+		},
+	}
+
+	for name, tr := range transports {
+		b.Run(name, func(b *testing.B) {
+			client := zts.NewClient(server.URL, tr)
+			for b.Loop() {
+				if _, err := client.GetResourceAccessExt("launch", "athenz.prod:service.api", "", "athenz.k8s.sandbox"); err != nil {
+					b.Fatal(err)
+				}
+			}
+			tr.CloseIdleConnections()
+		})
+	}
+}
@@ -0,0 +1,552 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AthenZ/athenz/clients/go/zts"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+	"github.com/cert-manager/issuer-lib/api/v1alpha1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+)
+
+const (
+	// ztsEndpointProbeInterval is how often the endpoints of every issuer
+	// are probed.
+	ztsEndpointProbeInterval = 30 * time.Second
+	ztsEndpointProbeTimeout  = 10 * time.Second
+
+	// ztsEndpointsFieldOwner owns status.ztsEndpoints. It differs from the
+	// field owner of issuer-lib, whose status patches would otherwise drop
+	// the field.
+	ztsEndpointsFieldOwner = "athenzissuer.cert-manager.athenz.io/zts-endpoints"
+)
+
+// ztsEndpoints returns the ZTS endpoints of an issuer, the first one is the
+// primary endpoint.
+func ztsEndpoints(spec *athenzissuerapi.AthenzCertificateSource) []athenzissuerapi.ZTSEndpoint {
+	if len(spec.ZTSEndpoints) > 0 {
+		return spec.ZTSEndpoints
+	}
+	if spec.ZTSEndpoint != "" {
+		return []athenzissuerapi.ZTSEndpoint{{URL: spec.ZTSEndpoint}}
+	}
+	return nil
+}
+
+type ztsEndpointState struct {
+	url     *url.URL
+	weight  int32
+	breaker *circuitBreaker
+
+	healthy        bool
+	lastTransition time.Time
+	message        string
+}
+
+// ztsEndpointPool tracks the health of the ZTS endpoints of an issuer and
+// picks the one requests are sent to. The active endpoint is kept as long as
+// it is healthy, once it fails the healthy endpoint with the highest weight,
+// then the earliest in the list takes over.
+type ztsEndpointPool struct {
+	// issuer names the issuer whose status the pool reports to
+	issuer   client.Object
+	config   string
+	breakers *circuitBreakerSet
+
+	// primaryURL is the URL clients are created for
+	primaryURL *url.URL
+	// srv is set when the endpoints are discovered through DNS
+	srv *ztsSRVName
+
+	mu         sync.Mutex
+	endpoints  []*ztsEndpointState
+	active     int
+	base       http.RoundTripper
+	changed    bool
+	resolvedAt time.Time
+	now        func() time.Time
+	lookupSRV  func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+func newZTSEndpointPool(issuer client.Object, endpoints []athenzissuerapi.ZTSEndpoint, breakers *circuitBreakerSet) (*ztsEndpointPool, error) {
+	pool := &ztsEndpointPool{issuer: issuer, breakers: breakers, active: -1, changed: true}
+	if len(endpoints) == 1 && strings.HasPrefix(endpoints[0].URL, ztsSRVPrefix) {
+		srv, err := parseZTSSRVName(endpoints[0].URL)
+		if err != nil {
+			return nil, err
+		}
+		pool.srv, pool.primaryURL = srv, srv.primaryURL()
+		return pool, nil
+	}
+
+	if err := pool.setEndpoints(endpoints); err != nil {
+		return nil, err
+	}
+	if len(pool.endpoints) == 0 {
+		return nil, fmt.Errorf("no ZTS endpoint configured")
+	}
+	pool.primaryURL = pool.endpoints[0].url
+	return pool, nil
+}
+
+// setEndpoints replaces the endpoints of the pool. Endpoints that remain
+// keep their health, and the active endpoint stays active while it remains.
+func (p *ztsEndpointPool) setEndpoints(endpoints []athenzissuerapi.ZTSEndpoint) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	existing := make(map[string]*ztsEndpointState, len(p.endpoints))
+	for _, endpoint := range p.endpoints {
+		existing[endpoint.url.String()] = endpoint
+	}
+	var active *ztsEndpointState
+	if p.active >= 0 {
+		active = p.endpoints[p.active]
+	}
+
+	states := make([]*ztsEndpointState, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		u, err := url.Parse(endpoint.URL)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("invalid ZTS endpoint %q", endpoint.URL)
+		}
+		weight := int32(1)
+		if endpoint.Weight != nil {
+			weight = *endpoint.Weight
+		}
+		state, ok := existing[u.String()]
+		if !ok {
+			state = &ztsEndpointState{
+				url:     u,
+				breaker: p.breakers.get(u.String()),
+				// endpoints are assumed healthy until they fail
+				healthy:        true,
+				lastTransition: p.clock(),
+			}
+		}
+		state.weight = weight
+		states = append(states, state)
+	}
+
+	changed := len(states) != len(p.endpoints)
+	for i := range states {
+		changed = changed || states[i] != p.endpoints[i]
+	}
+	p.endpoints, p.active, p.changed = states, -1, p.changed || changed
+	for i, state := range states {
+		if state == active {
+			p.active = i
+		}
+	}
+	if len(states) > 0 {
+		p.reselect()
+	}
+	return nil
+}
+
+func (p *ztsEndpointPool) clock() time.Time {
+	if p.now != nil {
+		return p.now()
+	}
+	return time.Now()
+}
+
+// primary returns the URL of the first endpoint. Clients are created for it
+// and their requests rewritten to the endpoint that serves them.
+func (p *ztsEndpointPool) primary() string {
+	return p.primaryURL.String()
+}
+
+func (p *ztsEndpointPool) snapshot() []*ztsEndpointState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.endpoints
+}
+
+func (p *ztsEndpointPool) urls() []string {
+	if p.srv != nil {
+		return []string{p.srv.String()}
+	}
+	endpoints := p.snapshot()
+	urls := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		urls = append(urls, endpoint.url.String())
+	}
+	return urls
+}
+
+// transport returns a transport that sends the requests of a client created
+// for the primary endpoint to the healthy endpoints of the pool.
+func (p *ztsEndpointPool) transport(base http.RoundTripper) http.RoundTripper {
+	return &failoverTransport{pool: p, base: base}
+}
+
+// unavailable reports whether the circuit breakers of all endpoints are
+// open, or no endpoint is known.
+func (p *ztsEndpointPool) unavailable() bool {
+	for _, endpoint := range p.snapshot() {
+		if !endpoint.breaker.isOpen() {
+			return false
+		}
+	}
+	return true
+}
+
+// candidates returns the endpoints in the order requests try them: the
+// active endpoint first, then the others by preference.
+func (p *ztsEndpointPool) candidates() []*ztsEndpointState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ranked := p.ranked()
+	if p.active >= 0 {
+		active := p.endpoints[p.active]
+		for i, endpoint := range ranked {
+			if endpoint == active {
+				copy(ranked[1:i+1], ranked[:i])
+				ranked[0] = active
+				break
+			}
+		}
+	}
+	return ranked
+}
+
+// ranked returns the endpoints ordered by preference, p.mu must be held.
+func (p *ztsEndpointPool) ranked() []*ztsEndpointState {
+	ranked := append([]*ztsEndpointState(nil), p.endpoints...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.healthy != b.healthy {
+			return a.healthy
+		}
+		return a.weight > b.weight
+	})
+	return ranked
+}
+
+// reselect moves away from the active endpoint once it is unhealthy, p.mu
+// must be held.
+func (p *ztsEndpointPool) reselect() {
+	if p.active >= 0 && p.endpoints[p.active].healthy {
+		return
+	}
+	best := p.ranked()[0]
+	if !best.healthy && p.active >= 0 {
+		// nothing better to move to
+		return
+	}
+	for i, endpoint := range p.endpoints {
+		if endpoint == best && i != p.active {
+			p.active, p.changed = i, true
+		}
+	}
+}
+
+// report records the outcome of a call to an endpoint.
+func (p *ztsEndpointPool) report(endpoint *ztsEndpointState, failure error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	healthy := failure == nil
+	message := ""
+	if failure != nil {
+		message = failure.Error()
+	}
+	if endpoint.healthy != healthy {
+		endpoint.healthy, endpoint.lastTransition, p.changed = healthy, p.clock(), true
+	}
+	if endpoint.message != message {
+		endpoint.message, p.changed = message, true
+	}
+	p.reselect()
+}
+
+// probe checks every endpoint with an unauthenticated status call. Endpoints
+// whose circuit breaker is open are only probed once it lets a call through.
+func (p *ztsEndpointPool) probe(ctx context.Context) {
+	p.mu.Lock()
+	base := p.base
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, endpoint := range p.snapshot() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client, cancel := ztsClientWithContext(ctx, zts.NewClient(endpoint.url.String(), &breakerTransport{breaker: endpoint.breaker, base: base}), &metav1.Duration{Duration: ztsEndpointProbeTimeout})
+			defer cancel()
+
+			_, err := client.GetStatus()
+			var open *circuitOpenError
+			if errors.As(err, &open) || ctx.Err() != nil {
+				return
+			}
+			if ztsAnswered(err) {
+				// probes carry no credentials, ZTS answering is what counts
+				err = nil
+			}
+			p.report(endpoint, err)
+		}()
+	}
+	wg.Wait()
+}
+
+// takeStatus returns the status of the endpoints when it changed since the
+// last call.
+func (p *ztsEndpointPool) takeStatus() ([]athenzissuerapi.ZTSEndpointStatus, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.changed {
+		return nil, false
+	}
+	p.changed = false
+	status := make([]athenzissuerapi.ZTSEndpointStatus, 0, len(p.endpoints))
+	for i, endpoint := range p.endpoints {
+		status = append(status, athenzissuerapi.ZTSEndpointStatus{
+			URL:                endpoint.url.String(),
+			Healthy:            endpoint.healthy,
+			Active:             i == p.active,
+			LastTransitionTime: &metav1.Time{Time: endpoint.lastTransition},
+			Message:            endpoint.message,
+		})
+	}
+	return status, true
+}
+
+func (p *ztsEndpointPool) markChanged() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.changed = true
+}
+
+// failoverTransport sends each request to the active endpoint of the pool and
+// retries it on the next endpoint when it could not be delivered. Requests
+// that may have reached ZTS are only retried when they are idempotent.
+type failoverTransport struct {
+	pool *ztsEndpointPool
+	base http.RoundTripper
+}
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	primary := t.pool.primaryURL
+	candidates := t.pool.candidates()
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no ZTS endpoint found for %s", strings.Join(t.pool.urls(), ", "))
+	}
+	var resp *http.Response
+	var err error
+	for i, endpoint := range candidates {
+		if i > 0 {
+			if !retryOnNextEndpoint(req, resp, err) {
+				break
+			}
+			if resp != nil {
+				resp.Body.Close()
+			}
+		}
+
+		r := req.Clone(req.Context())
+		r.URL = endpointURL(req.URL, primary, endpoint.url)
+		r.Host = ""
+		if i > 0 && req.Body != nil {
+			if r.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err = (&breakerTransport{breaker: endpoint.breaker, base: t.base}).RoundTrip(r)
+		var open *circuitOpenError
+		switch {
+		case errors.As(err, &open), req.Context().Err() != nil:
+			// says nothing new about the endpoint
+		case err != nil:
+			t.pool.report(endpoint, err)
+		case resp.StatusCode >= http.StatusInternalServerError:
+			t.pool.report(endpoint, fmt.Errorf("status %d", resp.StatusCode))
+		default:
+			t.pool.report(endpoint, nil)
+			return resp, nil
+		}
+	}
+	return resp, err
+}
+
+func (t *failoverTransport) CloseIdleConnections() {
+	if tr, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		tr.CloseIdleConnections()
+	}
+}
+
+// retryOnNextEndpoint reports whether a request that failed with resp or err
+// may be sent to another endpoint.
+func retryOnNextEndpoint(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil || (req.Body != nil && req.GetBody == nil) {
+		return false
+	}
+	var open *circuitOpenError
+	var opErr *net.OpError
+	if errors.As(err, &open) || (errors.As(err, &opErr) && opErr.Op == "dial") {
+		// the request never left
+		return true
+	}
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead
+	return idempotent && (err != nil || resp.StatusCode >= http.StatusInternalServerError)
+}
+
+// endpointURL rewrites u, a URL below primary, to the same location below
+// endpoint.
+func endpointURL(u, primary, endpoint *url.URL) *url.URL {
+	rewritten := *u
+	rewritten.Scheme = endpoint.Scheme
+	rewritten.Host = endpoint.Host
+	rewritten.Path = strings.TrimSuffix(endpoint.Path, "/") + strings.TrimPrefix(u.Path, strings.TrimSuffix(primary.Path, "/"))
+	rewritten.RawPath = ""
+	return &rewritten
+}
+
+// ztsEndpointPoolSet keeps the endpoint pool of every issuer. The zero value
+// is ready to use.
+type ztsEndpointPoolSet struct {
+	mu    sync.Mutex
+	pools map[types.NamespacedName]*ztsEndpointPool
+}
+
+// get returns the endpoint pool of an issuer, replacing it when its endpoints
+// changed. base is the transport the endpoints are probed with.
+func (s *ztsEndpointPoolSet) get(ctx context.Context, issuerObject v1alpha1.Issuer, endpoints []athenzissuerapi.ZTSEndpoint, breakers *circuitBreakerSet, base http.RoundTripper) (*ztsEndpointPool, error) {
+	config, err := json.Marshal(endpoints)
+	if err != nil {
+		return nil, err
+	}
+	issuer := types.NamespacedName{Namespace: issuerObject.GetNamespace(), Name: issuerObject.GetName()}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pool, ok := s.pools[issuer]
+	if !ok || pool.config != string(config) {
+		issuerRef := issuerObject.DeepCopyObject().(client.Object)
+		pool, err = newZTSEndpointPool(issuerRef, endpoints, breakers)
+		if err != nil {
+			return nil, signer.PermanentError{Err: err}
+		}
+		pool.config = string(config)
+		if s.pools == nil {
+			s.pools = make(map[types.NamespacedName]*ztsEndpointPool)
+		}
+		s.pools[issuer] = pool
+	}
+	pool.mu.Lock()
+	pool.base = base
+	pool.mu.Unlock()
+
+	if pool.srv != nil && pool.resolveDue() {
+		// a failed re-resolution keeps the endpoints found before
+		if err := pool.resolve(ctx); err != nil && len(pool.snapshot()) == 0 {
+			return nil, err
+		}
+	}
+	return pool, nil
+}
+
+func (s *ztsEndpointPoolSet) lookup(issuer types.NamespacedName) *ztsEndpointPool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pools[issuer]
+}
+
+func (s *ztsEndpointPoolSet) remove(issuer types.NamespacedName, pool *ztsEndpointPool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pools[issuer] == pool {
+		delete(s.pools, issuer)
+	}
+}
+
+func (s *ztsEndpointPoolSet) all() map[types.NamespacedName]*ztsEndpointPool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pools := make(map[types.NamespacedName]*ztsEndpointPool, len(s.pools))
+	for issuer, pool := range s.pools {
+		pools[issuer] = pool
+	}
+	return pools
+}
+
+// probeZTSEndpoints probes the ZTS endpoints of every issuer until ctx is
+// done, and writes their health to the issuer status when it changes.
+func (s *Signer) probeZTSEndpoints(ctx context.Context) error {
+	logger := ctrl.Log.WithName("zts-endpoints")
+	ticker := time.NewTicker(ztsEndpointProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		var wg sync.WaitGroup
+		for issuer, pool := range s.ztsEndpointPools.all() {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if pool.srv != nil && pool.resolveDue() {
+					if err := pool.resolve(ctx); err != nil {
+						logger.Error(err, "Failed to resolve the ZTS endpoints", "issuer", issuer)
+					}
+				}
+				pool.probe(ctx)
+				status, ok := pool.takeStatus()
+				if !ok {
+					return
+				}
+				err := s.applyIssuerStatus(ctx, pool.issuer, ztsEndpointsFieldOwner, map[string]any{"ztsEndpoints": status})
+				switch {
+				case apierrors.IsNotFound(err):
+					s.ztsEndpointPools.remove(issuer, pool)
+				case err != nil:
+					logger.Error(err, "Failed to update the ZTS endpoint status", "issuer", issuer)
+					pool.markChanged()
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
@@ -0,0 +1,224 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/AthenZ/athenz/clients/go/zts"
+
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+)
+
+// newStatusZTS starts a ZTS stand-in that answers with 503 while healthy is
+// false.
+func newStatusZTS(t *testing.T, healthy *atomic.Bool) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			http.Error(w, `{"code":503,"message":"unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"code":200,"message":"ok"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestZTSEndpointPoolFailover(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	var healthy atomic.Bool
+	healthy.Store(true)
+	up, calls := newStatusZTS(t, &healthy)
+
+	pool, err := newZTSEndpointPool(nil, []athenzissuerapi.ZTSEndpoint{{URL: down.URL + "/zts/v1"}, {URL: up.URL + "/zts/v1"}}, &circuitBreakerSet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := zts.NewClient(pool.primary(), pool.transport(nil))
+
+	// the connection error moves the request and the pool to the next endpoint
+	for range 2 {
+		if _, err := client.GetStatus(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected both calls to reach the healthy endpoint, got %d", calls.Load())
+	}
+	status, _ := pool.takeStatus()
+	if status[0].Healthy || status[0].Active || status[0].Message == "" {
+		t.Errorf("Expected the unreachable endpoint to be unhealthy, got %+v", status[0])
+	}
+	if !status[1].Healthy || !status[1].Active {
+		t.Errorf("Expected the reachable endpoint to be active, got %+v", status[1])
+	}
+	if _, changed := pool.takeStatus(); changed {
+		t.Errorf("Expected no status change without new outcomes")
+	}
+}
+
+func TestZTSEndpointPoolSticky(t *testing.T) {
+	var healthyA, healthyB atomic.Bool
+	healthyB.Store(true)
+	a, callsA := newStatusZTS(t, &healthyA)
+	b, callsB := newStatusZTS(t, &healthyB)
+
+	weight := int32(2)
+	pool, err := newZTSEndpointPool(nil, []athenzissuerapi.ZTSEndpoint{{URL: b.URL}, {URL: a.URL, Weight: &weight}}, &circuitBreakerSet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := zts.NewClient(pool.primary(), pool.transport(nil))
+
+	// a has the higher weight and is tried first, its 503 fails the GET over
+	if _, err := client.GetStatus(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if callsA.Load() != 1 || callsB.Load() != 1 {
+		t.Errorf("Expected one call to each endpoint, got %d and %d", callsA.Load(), callsB.Load())
+	}
+
+	// a recovering does not move requests away from b
+	healthyA.Store(true)
+	pool.probe(context.Background())
+	if _, err := client.GetStatus(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if callsB.Load() != 3 {
+		t.Errorf("Expected requests to stick to b, got %d calls", callsB.Load())
+	}
+
+	// until b fails
+	healthyB.Store(false)
+	if _, err := client.GetStatus(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := client.GetStatus(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if callsB.Load() != 4 || callsA.Load() != 4 {
+		t.Errorf("Expected the failed endpoint to be left after one call, got %d calls to a and %d to b", callsA.Load(), callsB.Load())
+	}
+}
+
+func TestZTSEndpointPoolRanked(t *testing.T) {
+	newState := func(name string, weight int32, healthy bool) *ztsEndpointState {
+		return &ztsEndpointState{url: &url.URL{Host: name}, weight: weight, healthy: healthy}
+	}
+
+	testCases := []struct {
+		name      string
+		endpoints []*ztsEndpointState
+		expected  []string
+	}{
+		{
+			name:      "list order for equal weights",
+			endpoints: []*ztsEndpointState{newState("a", 1, true), newState("b", 1, true), newState("c", 1, true)},
+			expected:  []string{"a", "b", "c"},
+		},
+		{
+			name:      "higher weights first",
+			endpoints: []*ztsEndpointState{newState("a", 1, true), newState("b", 2, true), newState("c", 1, true)},
+			expected:  []string{"b", "a", "c"},
+		},
+		{
+			name:      "healthy endpoints first",
+			endpoints: []*ztsEndpointState{newState("a", 2, false), newState("b", 1, true), newState("c", 1, true)},
+			expected:  []string{"b", "c", "a"},
+		},
+	}
+
+	for _, tc := range testCases {
+		pool := &ztsEndpointPool{endpoints: tc.endpoints}
+		var names []string
+		for _, endpoint := range pool.ranked() {
+			names = append(names, endpoint.url.Host)
+		}
+		if !slices.Equal(names, tc.expected) {
+			t.Errorf("%s: expected %v, but got %v", tc.name, tc.expected, names)
+		}
+	}
+}
+
+func TestZTSEndpointPoolNoRetryAfterDelivery(t *testing.T) {
+	var healthyA, healthyB atomic.Bool
+	healthyB.Store(true)
+	a, _ := newStatusZTS(t, &healthyA)
+	b, callsB := newStatusZTS(t, &healthyB)
+
+	pool, err := newZTSEndpointPool(nil, []athenzissuerapi.ZTSEndpoint{{URL: a.URL}, {URL: b.URL}}, &circuitBreakerSet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := zts.NewClient(pool.primary(), pool.transport(nil))
+
+	// the instance may have been registered, the request is not repeated
+	if _, _, err := client.PostInstanceRegisterInformation(&zts.InstanceRegisterInformation{}); err == nil {
+		t.Fatalf("Expected the error of the first endpoint")
+	}
+	if callsB.Load() != 0 {
+		t.Errorf("Expected the POST not to be retried on another endpoint")
+	}
+	if status, _ := pool.takeStatus(); !status[1].Active {
+		t.Errorf("Expected later requests to go to the healthy endpoint")
+	}
+}
+
+func TestEndpointURL(t *testing.T) {
+	testCases := []struct {
+		request  string
+		primary  string
+		endpoint string
+		expected string
+	}{
+		{
+			request:  "https://zts-a.example:4443/zts/v1/instance",
+			primary:  "https://zts-a.example:4443/zts/v1",
+			endpoint: "https://zts-b.example:4443/zts/v1",
+			expected: "https://zts-b.example:4443/zts/v1/instance",
+		},
+		{
+			request:  "https://zts-a.example/zts/v1/access/launch?principal=p",
+			primary:  "https://zts-a.example/zts/v1/",
+			endpoint: "https://zts-b.example/v1",
+			expected: "https://zts-b.example/v1/access/launch?principal=p",
+		},
+	}
+
+	for _, tc := range testCases {
+		parse := func(s string) *url.URL {
+			u, err := url.Parse(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return u
+		}
+		if got := endpointURL(parse(tc.request), parse(tc.primary), parse(tc.endpoint)).String(); got != tc.expected {
+			t.Errorf("Expected %s, but got %s", tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+)
+
+// ztsLimiter enforces the concurrency and rate limits of an issuer. A nil
+// semaphore or rate limiter means that limit is not set.
+type ztsLimiter struct {
+	semaphore chan struct{}
+	rate      *rate.Limiter
+}
+
+func newZTSLimiter(maxConcurrentRequests, requestsPerSecond *int32) *ztsLimiter {
+	l := &ztsLimiter{}
+	if maxConcurrentRequests != nil && *maxConcurrentRequests > 0 {
+		l.semaphore = make(chan struct{}, *maxConcurrentRequests)
+	}
+	if requestsPerSecond != nil && *requestsPerSecond > 0 {
+		l.rate = rate.NewLimiter(rate.Limit(*requestsPerSecond), int(*requestsPerSecond))
+	}
+	return l
+}
+
+// tryAcquire takes a slot without waiting. It returns the function releasing
+// the slot, or the limit that was hit.
+func (l *ztsLimiter) tryAcquire() (func(), string) {
+	release := func() {}
+	if l.semaphore != nil {
+		select {
+		case l.semaphore <- struct{}{}:
+			release = func() { <-l.semaphore }
+		default:
+			return nil, "concurrency"
+		}
+	}
+	if l.rate != nil && !l.rate.Allow() {
+		release()
+		return nil, "rate"
+	}
+	return release, ""
+}
+
+type ztsLimiterEntry struct {
+	maxConcurrentRequests int32
+	requestsPerSecond     int32
+	limiter               *ztsLimiter
+}
+
+// ztsLimiterSet keeps the limiter of every issuer. A limiter is only replaced
+// when the limits of its issuer change, so re-checks of the issuer do not
+// reset the slots in use. The zero value is ready to use.
+type ztsLimiterSet struct {
+	mu      sync.Mutex
+	entries map[types.NamespacedName]ztsLimiterEntry
+}
+
+func (s *ztsLimiterSet) get(issuer types.NamespacedName, maxConcurrentRequests, requestsPerSecond *int32) *ztsLimiter {
+	value := func(v *int32) int32 {
+		if v == nil {
+			return 0
+		}
+		return *v
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[issuer]
+	if ok && entry.maxConcurrentRequests == value(maxConcurrentRequests) && entry.requestsPerSecond == value(requestsPerSecond) {
+		return entry.limiter
+	}
+	if s.entries == nil {
+		s.entries = make(map[types.NamespacedName]ztsLimiterEntry)
+	}
+	entry = ztsLimiterEntry{
+		maxConcurrentRequests: value(maxConcurrentRequests),
+		requestsPerSecond:     value(requestsPerSecond),
+		limiter:               newZTSLimiter(maxConcurrentRequests, requestsPerSecond),
+	}
+	s.entries[issuer] = entry
+	return entry.limiter
+}
+
+// acquire takes a slot of the issuer, returning a pending error when the
+// issuer is at one of its limits so the request is requeued instead of
+// failed.
+func (s *ztsLimiterSet) acquire(issuer types.NamespacedName, maxConcurrentRequests, requestsPerSecond *int32) (func(), error) {
+	release, limit := s.get(issuer, maxConcurrentRequests, requestsPerSecond).tryAcquire()
+	if release == nil {
+		ztsThrottledRequestsTotal.WithLabelValues(strings.TrimPrefix(issuer.String(), "/"), limit).Inc()
+		return nil, signer.PendingError{Err: fmt.Errorf("issuer is at its %s limit towards ZTS, retrying later", limit)}
+	}
+	return release, nil
+}
@@ -0,0 +1,73 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+)
+
+func TestZTSLimiterSet(t *testing.T) {
+	limits := &ztsLimiterSet{}
+	issuer := types.NamespacedName{Namespace: "sandbox", Name: "issuer"}
+
+	t.Run("concurrency", func(t *testing.T) {
+		first, err := limits.acquire(issuer, ptr.To[int32](2), nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := limits.acquire(issuer, ptr.To[int32](2), nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err = limits.acquire(issuer, ptr.To[int32](2), nil)
+		if !errors.As(err, &signer.PendingError{}) {
+			t.Fatalf("Expected a pending error over the concurrency limit, got %v", err)
+		}
+
+		first()
+		if _, err := limits.acquire(issuer, ptr.To[int32](2), nil); err != nil {
+			t.Errorf("Expected a released slot to be reusable, got %v", err)
+		}
+	})
+
+	t.Run("rate", func(t *testing.T) {
+		for range 3 {
+			release, err := limits.acquire(issuer, nil, ptr.To[int32](3))
+			if err != nil {
+				t.Fatalf("Unexpected error within the burst: %v", err)
+			}
+			release()
+		}
+		if _, err := limits.acquire(issuer, nil, ptr.To[int32](3)); !errors.As(err, &signer.PendingError{}) {
+			t.Errorf("Expected a pending error over the rate limit, got %v", err)
+		}
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		other := types.NamespacedName{Name: "cluster-issuer"}
+		for range 100 {
+			if _, err := limits.acquire(other, nil, nil); err != nil {
+				t.Fatalf("Unexpected error without limits: %v", err)
+			}
+		}
+	})
+}
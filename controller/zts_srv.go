@@ -0,0 +1,140 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+)
+
+const (
+	// ztsSRVPrefix marks a ZTS endpoint that is looked up as a DNS SRV
+	// record, e.g. srv+_zts._tcp.athenz.example or
+	// srv+_zts._tcp.athenz.example/zts/v1.
+	ztsSRVPrefix = "srv+"
+
+	defaultZTSSRVPath = "/zts/v1"
+
+	// ztsSRVResolveInterval is how often SRV records are looked up again.
+	ztsSRVResolveInterval = 5 * time.Minute
+)
+
+// ztsSRVName is a ZTS endpoint given as a DNS SRV record.
+type ztsSRVName struct {
+	// name of the SRV record, e.g. _zts._tcp.athenz.example
+	name string
+	// path of the ZTS API on the targets
+	path string
+}
+
+func parseZTSSRVName(endpoint string) (*ztsSRVName, error) {
+	name, path, _ := strings.Cut(strings.TrimPrefix(endpoint, ztsSRVPrefix), "/")
+	labels := strings.SplitN(strings.TrimSuffix(name, "."), ".", 3)
+	if len(labels) != 3 || !strings.HasPrefix(labels[0], "_") || !strings.HasPrefix(labels[1], "_") || labels[2] == "" {
+		return nil, fmt.Errorf("invalid ZTS SRV endpoint %q, expected %s_<service>._<proto>.<domain>[/<path>]", endpoint, ztsSRVPrefix)
+	}
+	srv := &ztsSRVName{name: strings.TrimSuffix(name, "."), path: defaultZTSSRVPath}
+	if path != "" {
+		srv.path = "/" + path
+	}
+	return srv, nil
+}
+
+func (n *ztsSRVName) String() string {
+	return ztsSRVPrefix + n.name + n.path
+}
+
+// domain returns the domain the SRV record is published for.
+func (n *ztsSRVName) domain() string {
+	return strings.SplitN(n.name, ".", 3)[2]
+}
+
+// primaryURL is the URL clients are created for, and ServiceAccount tokens
+// minted for, whatever targets the record currently has.
+func (n *ztsSRVName) primaryURL() *url.URL {
+	return &url.URL{Scheme: "https", Host: n.domain(), Path: n.path}
+}
+
+// ztsSRVEndpoints turns SRV records into ZTS endpoints. Records of a lower
+// priority get a higher weight, so they are preferred over all records of a
+// higher priority. Records of the same priority are kept in the order the
+// resolver put them in, which is randomized by their weight.
+func ztsSRVEndpoints(records []*net.SRV, path string) []athenzissuerapi.ZTSEndpoint {
+	targets := make([]*net.SRV, 0, len(records))
+	var lowestPriority uint16
+	for _, record := range records {
+		// a target of "." means the service is decidedly not available
+		if record.Target != "." {
+			targets = append(targets, record)
+			lowestPriority = max(lowestPriority, record.Priority)
+		}
+	}
+	endpoints := make([]athenzissuerapi.ZTSEndpoint, 0, len(targets))
+	for _, record := range targets {
+		weight := int32(lowestPriority-record.Priority) + 1
+		endpoints = append(endpoints, athenzissuerapi.ZTSEndpoint{
+			URL: (&url.URL{
+				Scheme: "https",
+				Host:   net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port))),
+				Path:   path,
+			}).String(),
+			Weight: &weight,
+		})
+	}
+	return endpoints
+}
+
+func (p *ztsEndpointPool) resolveDue() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.resolvedAt.IsZero() || p.clock().Sub(p.resolvedAt) >= ztsSRVResolveInterval
+}
+
+// resolve looks up the SRV record of the pool and replaces its endpoints with
+// the targets found.
+func (p *ztsEndpointPool) resolve(ctx context.Context) error {
+	lookup := p.lookupSRV
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupSRV
+	}
+	ctx, cancel := context.WithTimeout(ctx, ztsEndpointProbeTimeout)
+	defer cancel()
+
+	_, records, err := lookup(ctx, "", "", p.srv.name)
+	if err != nil {
+		return fmt.Errorf("failed to look up the ZTS SRV record %s: %w", p.srv.name, err)
+	}
+	endpoints := ztsSRVEndpoints(records, p.srv.path)
+	if len(endpoints) == 0 {
+		return fmt.Errorf("the ZTS SRV record %s has no targets", p.srv.name)
+	}
+	if err := p.setEndpoints(endpoints); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.resolvedAt = p.clock()
+	p.mu.Unlock()
+	return nil
+}
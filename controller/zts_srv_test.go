@@ -0,0 +1,154 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	athenzissuerapi "github.com/AthenZ/athenz-issuer/v1"
+)
+
+func TestParseZTSSRVName(t *testing.T) {
+	testCases := []struct {
+		endpoint        string
+		expectedName    string
+		expectedPrimary string
+		expectError     bool
+	}{
+		{
+			endpoint:        "srv+_zts._tcp.athenz.example",
+			expectedName:    "_zts._tcp.athenz.example",
+			expectedPrimary: "https://athenz.example/zts/v1",
+		},
+		{
+			endpoint:        "srv+_zts._tcp.athenz.example./api",
+			expectedName:    "_zts._tcp.athenz.example",
+			expectedPrimary: "https://athenz.example/api",
+		},
+		{endpoint: "srv+zts.athenz.example", expectError: true},
+		{endpoint: "srv+_zts._tcp", expectError: true},
+	}
+
+	for _, tc := range testCases {
+		srv, err := parseZTSSRVName(tc.endpoint)
+		if tc.expectError {
+			if err == nil {
+				t.Errorf("Expected an error for %s", tc.endpoint)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", tc.endpoint, err)
+		}
+		if srv.name != tc.expectedName || srv.primaryURL().String() != tc.expectedPrimary {
+			t.Errorf("Expected %s and %s, but got %s and %s", tc.expectedName, tc.expectedPrimary, srv.name, srv.primaryURL())
+		}
+	}
+}
+
+func TestZTSSRVEndpoints(t *testing.T) {
+	endpoints := ztsSRVEndpoints([]*net.SRV{
+		{Target: "zts-a.athenz.example.", Port: 4443, Priority: 10, Weight: 60},
+		{Target: "zts-b.athenz.example.", Port: 4443, Priority: 10, Weight: 40},
+		{Target: "zts-c.athenz.example.", Port: 443, Priority: 20},
+		{Target: ".", Port: 0, Priority: 30},
+	}, "/zts/v1")
+
+	expected := []struct {
+		url    string
+		weight int32
+	}{
+		{url: "https://zts-a.athenz.example:4443/zts/v1", weight: 11},
+		{url: "https://zts-b.athenz.example:4443/zts/v1", weight: 11},
+		{url: "https://zts-c.athenz.example:443/zts/v1", weight: 1},
+	}
+	if len(endpoints) != len(expected) {
+		t.Fatalf("Expected %d endpoints, but got %d", len(expected), len(endpoints))
+	}
+	for i, e := range expected {
+		if endpoints[i].URL != e.url || *endpoints[i].Weight != e.weight {
+			t.Errorf("Expected %s with weight %d, but got %s with weight %d", e.url, e.weight, endpoints[i].URL, *endpoints[i].Weight)
+		}
+	}
+}
+
+func TestZTSEndpointPoolResolve(t *testing.T) {
+	records := []*net.SRV{
+		{Target: "zts-a.athenz.example.", Port: 4443, Priority: 10},
+		{Target: "zts-b.athenz.example.", Port: 4443, Priority: 20},
+	}
+	var lookupErr error
+	lookups := 0
+
+	pool, err := newZTSEndpointPool(nil, []athenzissuerapi.ZTSEndpoint{{URL: "srv+_zts._tcp.athenz.example"}}, &circuitBreakerSet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	pool.now = func() time.Time { return now }
+	pool.lookupSRV = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		lookups++
+		if name != "_zts._tcp.athenz.example" {
+			t.Errorf("Unexpected SRV lookup for %s", name)
+		}
+		return name, records, lookupErr
+	}
+
+	if pool.primary() != "https://athenz.example/zts/v1" {
+		t.Errorf("Unexpected primary endpoint %s", pool.primary())
+	}
+	if !pool.resolveDue() {
+		t.Fatalf("Expected a new pool to be resolved")
+	}
+	if err := pool.resolve(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if candidates := pool.candidates(); len(candidates) != 2 || candidates[0].url.Host != "zts-a.athenz.example:4443" {
+		t.Errorf("Expected zts-a to be preferred, got %v", pool.urls())
+	}
+	if pool.resolveDue() {
+		t.Errorf("Expected no lookup before the resolve interval passed")
+	}
+
+	// a target that remains keeps its health, a new one is added
+	pool.report(pool.candidates()[0], errors.New("connection refused"))
+	records = []*net.SRV{
+		{Target: "zts-a.athenz.example.", Port: 4443, Priority: 10},
+		{Target: "zts-c.athenz.example.", Port: 4443, Priority: 10},
+	}
+	now = now.Add(ztsSRVResolveInterval)
+	if err := pool.resolve(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	status, _ := pool.takeStatus()
+	if len(status) != 2 || status[0].Healthy || !status[1].Healthy || !status[1].Active {
+		t.Errorf("Expected zts-a to stay unhealthy and zts-c to take over, got %+v", status)
+	}
+
+	// a failed lookup keeps the endpoints
+	lookupErr = errors.New("no such host")
+	if err := pool.resolve(context.Background()); err == nil {
+		t.Errorf("Expected the lookup error")
+	}
+	if len(pool.snapshot()) != 2 || lookups != 3 {
+		t.Errorf("Expected the endpoints to be kept after %d lookups", lookups)
+	}
+}
@@ -16,21 +16,93 @@ limitations under the License.
 package issuerutil
 
 import (
+	"bytes"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"net/url"
+	"path"
 	"regexp"
+	"slices"
 	"strings"
 )
 
 const (
-	SpiffeUriPattern = `^spiffe://[^/]+/ns/([^/]+)/sa/([^/]+)$`
+	SpiffeUriPattern              = `^spiffe://[^/]+/ns/([^/]+)/sa/([^/]+)$`
+	AthenzServiceSpiffeUriPattern = `^spiffe://[^/]+/sa/([^/]+)$`
 )
 
 var (
-	regex = regexp.MustCompile(SpiffeUriPattern)
+	regex              = regexp.MustCompile(SpiffeUriPattern)
+	athenzServiceRegex = regexp.MustCompile(AthenzServiceSpiffeUriPattern)
 )
 
+// SpiffeURIFormat selects how a SPIFFE URI is mapped to an Athenz identity.
+type SpiffeURIFormat string
+
+const (
+	// SpiffeURIFormatKubernetes is spiffe://<trust-domain>/ns/<namespace>/sa/<service-account>
+	// where the service account is named <domain>.<service>, or just <service>.
+	SpiffeURIFormatKubernetes SpiffeURIFormat = "Kubernetes"
+
+	// SpiffeURIFormatAthenzService is the Athenz service format spiffe://<domain>/sa/<service>.
+	// The URI carries no namespace, it has to come from the request.
+	SpiffeURIFormatAthenzService SpiffeURIFormat = "AthenzService"
+
+	// SpiffeURIFormatAthenzNamespace is the Athenz namespaced format
+	// spiffe://<trust-domain>/ns/<namespace>/sa/<domain>.<service>.
+	SpiffeURIFormatAthenzNamespace SpiffeURIFormat = "AthenzNamespace"
+)
+
+// SpiffeIdentity is the workload identity carried by a SPIFFE URI.
+type SpiffeIdentity struct {
+	TrustDomain string
+	// Namespace is the Kubernetes namespace of the workload, empty when the
+	// format does not carry one.
+	Namespace string
+	// ServiceAccount is the Kubernetes service account the identity maps to.
+	ServiceAccount string
+	Domain         string
+	Service        string
+}
+
+// ParseSpiffeURI parses a spiffe uri in the given format, an empty format
+// defaults to SpiffeURIFormatKubernetes
+// e.g spiffe://cluster.local/ns/default/sa/athenz.example => cluster.local, default, athenz.example, athenz, example
+func ParseSpiffeURI(spiffeURI string, format SpiffeURIFormat) (*SpiffeIdentity, error) {
+	trustDomain, err := ExtractTrustDomainFromSpiffeURI(spiffeURI)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &SpiffeIdentity{TrustDomain: trustDomain}
+	switch format {
+	case "", SpiffeURIFormatKubernetes, SpiffeURIFormatAthenzNamespace:
+		matches := regex.FindStringSubmatch(spiffeURI)
+		if len(matches) != 3 {
+			return nil, fmt.Errorf("invalid SPIFFE URI format")
+		}
+		identity.Namespace = matches[1]
+		identity.ServiceAccount = matches[2]
+		identity.Domain, identity.Service = ExtractDomainServiceFromServiceAccount(matches[2])
+		if format == SpiffeURIFormatAthenzNamespace && identity.Domain == "" {
+			return nil, fmt.Errorf("invalid SPIFFE URI format: %q is not of the form <domain>.<service>", matches[2])
+		}
+	case SpiffeURIFormatAthenzService:
+		matches := athenzServiceRegex.FindStringSubmatch(spiffeURI)
+		if len(matches) != 2 {
+			return nil, fmt.Errorf("invalid SPIFFE URI format")
+		}
+		identity.Domain = trustDomain
+		identity.Service = matches[1]
+		identity.ServiceAccount = trustDomain + "." + matches[1]
+	default:
+		return nil, fmt.Errorf("unsupported SPIFFE URI format %q", format)
+	}
+
+	return identity, nil
+}
+
 // ExtractNamespaceAndServiceAccountFromSpiffeURI Given a spiffe uri in the format of spiffe://<trust-domain>/ns/<ns>/sa/<sa>
 // write a function in golang to return the namespace and service account name
 // e.g spiffe://cluster.local/ns/default/sa/athenz.example => return default, athenz.example
@@ -48,6 +120,132 @@ func ExtractNamespaceAndServiceAccountFromSpiffeURI(spiffeURI string) (string, s
 	return namespace, serviceAccount, nil
 }
 
+// ExtractTrustDomainFromSpiffeURI returns the trust domain of a spiffe uri
+// e.g spiffe://cluster.local/ns/default/sa/athenz.example => return cluster.local
+func ExtractTrustDomainFromSpiffeURI(spiffeURI string) (string, error) {
+	u, err := url.Parse(spiffeURI)
+	if err != nil {
+		return "", fmt.Errorf("invalid SPIFFE URI: %w", err)
+	}
+	if u.Scheme != "spiffe" || u.Host == "" || u.User != nil || u.Port() != "" {
+		return "", fmt.Errorf("invalid SPIFFE URI format")
+	}
+	return u.Host, nil
+}
+
+// IsTrustDomainAllowed reports whether the trust domain is in the allow list.
+// An empty allow list accepts every trust domain.
+func IsTrustDomainAllowed(trustDomain string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(allowed, func(td string) bool {
+		return strings.EqualFold(td, trustDomain)
+	})
+}
+
+// MatchAthenzNamePatterns reports whether an Athenz domain or service name
+// matches any of the glob patterns, e.g. corp.payments.* matches corp.payments.api
+// but not corp.payments itself.
+func MatchAthenzNamePatterns(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateAthenzNamePatterns returns an error for the first malformed glob pattern.
+func ValidateAthenzNamePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// WorkloadAnnotationKeys lists, per workload attribute, the request
+// annotation keys that are checked in order.
+type WorkloadAnnotationKeys struct {
+	SpiffeURI      []string
+	PodName        []string
+	PodNamespace   []string
+	PodUID         []string
+	ServiceAccount []string
+}
+
+var (
+	// DefaultWorkloadAnnotationKeys are the keys set by the Athenz csi driver.
+	DefaultWorkloadAnnotationKeys = WorkloadAnnotationKeys{
+		SpiffeURI: []string{"csi.cert-manager.athenz.io/identity"},
+	}
+
+	// CSIPodInfoAnnotationKeys are the pod info keys Kubernetes hands to CSI
+	// drivers on mount, which the cert-manager csi drivers copy onto the
+	// requests they create.
+	CSIPodInfoAnnotationKeys = WorkloadAnnotationKeys{
+		PodName:        []string{"csi.storage.k8s.io/pod.name"},
+		PodNamespace:   []string{"csi.storage.k8s.io/pod.namespace"},
+		PodUID:         []string{"csi.storage.k8s.io/pod.uid"},
+		ServiceAccount: []string{"csi.storage.k8s.io/serviceAccount.name"},
+	}
+)
+
+// Merge returns the keys of k followed by the keys of other.
+func (k WorkloadAnnotationKeys) Merge(other WorkloadAnnotationKeys) WorkloadAnnotationKeys {
+	return WorkloadAnnotationKeys{
+		SpiffeURI:      append(slices.Clone(k.SpiffeURI), other.SpiffeURI...),
+		PodName:        append(slices.Clone(k.PodName), other.PodName...),
+		PodNamespace:   append(slices.Clone(k.PodNamespace), other.PodNamespace...),
+		PodUID:         append(slices.Clone(k.PodUID), other.PodUID...),
+		ServiceAccount: append(slices.Clone(k.ServiceAccount), other.ServiceAccount...),
+	}
+}
+
+// WorkloadAnnotations is the workload information found on a request.
+type WorkloadAnnotations struct {
+	SpiffeURI      string
+	PodName        string
+	PodNamespace   string
+	PodUID         string
+	ServiceAccount string
+}
+
+// ExtractWorkloadAnnotations returns, for every attribute, the value of the
+// first of its keys that is set on the request.
+func ExtractWorkloadAnnotations(annotations map[string]string, keys WorkloadAnnotationKeys) WorkloadAnnotations {
+	first := func(keys []string) string {
+		for _, key := range keys {
+			if value, ok := annotations[key]; ok && value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+	return WorkloadAnnotations{
+		SpiffeURI:      first(keys.SpiffeURI),
+		PodName:        first(keys.PodName),
+		PodNamespace:   first(keys.PodNamespace),
+		PodUID:         first(keys.PodUID),
+		ServiceAccount: first(keys.ServiceAccount),
+	}
+}
+
+// IdentityFromServiceAccount builds the identity of a service account when no
+// SPIFFE URI is available, the trust domain is left empty.
+// e.g. default, athenz.prod.api => default, athenz.prod.api, athenz.prod, api
+func IdentityFromServiceAccount(namespace, serviceAccount string) *SpiffeIdentity {
+	domain, service := ExtractDomainServiceFromServiceAccount(serviceAccount)
+	return &SpiffeIdentity{
+		Namespace:      namespace,
+		ServiceAccount: serviceAccount,
+		Domain:         domain,
+		Service:        service,
+	}
+}
+
 func ExtractSpiffeURIFromAnnotations(annotations map[string]string) (string, error) {
 	spiffeURI, ok := annotations["csi.cert-manager.athenz.io/identity"]
 	if !ok {
@@ -68,6 +266,41 @@ func ExtractDomainServiceFromServiceAccount(saName string) (string, string) {
 	return domain, service
 }
 
+// ParseCertificatesPEM parses every CERTIFICATE block of a PEM bundle.
+func ParseCertificatesPEM(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// EncodeCertificatesPEM encodes the certificates as a PEM bundle.
+func EncodeCertificatesPEM(certs []*x509.Certificate) []byte {
+	var out []byte
+	for _, cert := range certs {
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return out
+}
+
+// IsSelfSigned reports whether the certificate is a self-signed root.
+func IsSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
+
 func ExtractSpiffeURIFromCSR(csrBytes []byte) (string, error) {
 	// Decode the PEM encoded CSR
 	block, rest := pem.Decode(csrBytes)
@@ -96,3 +329,117 @@ func ExtractSpiffeURIFromCSR(csrBytes []byte) (string, error) {
 
 	return "", fmt.Errorf("unable to extract SPIFFE URI from CSR")
 }
+
+// AthenzSANPolicy configures ValidateAthenzCSR.
+type AthenzSANPolicy struct {
+	// DNSSuffixes lists the suffixes DNS SANs may use, e.g. athenz.cloud.
+	// When empty no DNS SAN is accepted.
+	DNSSuffixes []string
+	// AllowIPAddresses accepts IP SANs.
+	AllowIPAddresses bool
+	// AllowWildcards accepts *.<service>.<domain-with-dashes>.<suffix> DNS
+	// SANs.
+	AllowWildcards bool
+}
+
+// ValidateAthenzCSR checks the names requested by a CSR against the
+// conventions ZTS enforces for the service domain.service, so that
+// nonconforming requests fail before a round trip to ZTS:
+//   - the common name is <domain>.<service>
+//   - DNS SANs are <service>.<domain-with-dashes>.<suffix> for one of the
+//     DNS suffixes of the policy
+//   - URI SANs are spiffe://<domain>/sa/<service>,
+//     spiffe://<trust-domain>/ns/<namespace>/sa/<domain>.<service> or
+//     athenz://instanceid/<provider>/<instance-id>
+//   - IP SANs and wildcard DNS SANs are only accepted when the policy allows
+//     them
+//
+// Every violation is listed in the returned error.
+func ValidateAthenzCSR(template *x509.Certificate, domain, service string, policy AthenzSANPolicy) error {
+	var violations []string
+	name := domain + "." + service
+	if !strings.EqualFold(template.Subject.CommonName, name) {
+		violations = append(violations, fmt.Sprintf("common name %q must be %s", template.Subject.CommonName, name))
+	}
+
+	host := service + "." + strings.ReplaceAll(domain, ".", "-")
+	for _, dnsName := range template.DNSNames {
+		if err := validateAthenzDNSName(strings.ToLower(dnsName), host, policy); err != nil {
+			violations = append(violations, err.Error())
+		}
+	}
+
+	for _, uri := range template.URIs {
+		if !isAthenzURI(uri, domain, service) {
+			violations = append(violations, fmt.Sprintf("URI SAN %q must be spiffe://%s/sa/%s, spiffe://<trust-domain>/ns/<namespace>/sa/%s or athenz://instanceid/<provider>/<instance-id>", uri, domain, service, name))
+		}
+	}
+
+	if len(template.IPAddresses) > 0 && !policy.AllowIPAddresses {
+		violations = append(violations, fmt.Sprintf("IP SANs %v are not allowed", template.IPAddresses))
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("the CSR does not follow the Athenz conventions for %s: %s", name, strings.Join(violations, "; "))
+	}
+	return nil
+}
+
+func validateAthenzDNSName(dnsName, host string, policy AthenzSANPolicy) error {
+	if len(policy.DNSSuffixes) == 0 {
+		return fmt.Errorf("DNS SAN %q is not allowed, the issuer has no DNS suffixes", dnsName)
+	}
+	name := dnsName
+	if wildcard, ok := strings.CutPrefix(dnsName, "*."); ok {
+		if !policy.AllowWildcards {
+			return fmt.Errorf("wildcard DNS SAN %q is not allowed", dnsName)
+		}
+		name = wildcard
+	}
+	for _, suffix := range policy.DNSSuffixes {
+		if name == host+"."+strings.ToLower(strings.Trim(suffix, ".")) {
+			return nil
+		}
+	}
+	return fmt.Errorf("DNS SAN %q must be %s.<suffix> for one of the DNS suffixes %v", dnsName, host, policy.DNSSuffixes)
+}
+
+func isAthenzURI(uri *url.URL, domain, service string) bool {
+	switch uri.Scheme {
+	case "spiffe":
+		if strings.EqualFold(uri.Host, domain) && uri.Path == "/sa/"+service {
+			return true
+		}
+		namespaced := regex.FindStringSubmatch(uri.String())
+		return namespaced != nil && namespaced[2] == domain+"."+service
+	case "athenz":
+		_, _, ok := parseAthenzInstanceURI(uri)
+		return ok
+	}
+	return false
+}
+
+// parseAthenzInstanceURI splits an athenz://instanceid/<provider>/<instance-id>
+// URI into its provider and instance ID.
+func parseAthenzInstanceURI(uri *url.URL) (string, string, bool) {
+	if uri.Scheme != "athenz" || uri.Host != "instanceid" {
+		return "", "", false
+	}
+	provider, instanceID, ok := strings.Cut(strings.TrimPrefix(uri.Path, "/"), "/")
+	if !ok || provider == "" || instanceID == "" || strings.Contains(instanceID, "/") {
+		return "", "", false
+	}
+	return provider, instanceID, true
+}
+
+// ExtractAthenzInstanceID returns the instance ID of the
+// athenz://instanceid/<provider>/<instance-id> URI SAN the CSR requests for
+// the given provider.
+func ExtractAthenzInstanceID(template *x509.Certificate, provider string) (string, error) {
+	for _, uri := range template.URIs {
+		if p, instanceID, ok := parseAthenzInstanceURI(uri); ok && p == provider {
+			return instanceID, nil
+		}
+	}
+	return "", fmt.Errorf("the CSR has no athenz://instanceid/%s/<instance-id> URI SAN", provider)
+}
@@ -97,6 +97,116 @@ func TestExtractNamespaceAndServiceAccountFromSpiffeURI(t *testing.T) {
 	}
 }
 
+func TestParseSpiffeURI(t *testing.T) {
+	testCases := []struct {
+		name        string
+		input       string
+		format      SpiffeURIFormat
+		expected    *SpiffeIdentity
+		expectError bool
+	}{
+		{
+			name:   "kubernetes format is the default",
+			input:  "spiffe://cluster.local/ns/default/sa/athenz.example",
+			format: "",
+			expected: &SpiffeIdentity{
+				TrustDomain:    "cluster.local",
+				Namespace:      "default",
+				ServiceAccount: "athenz.example",
+				Domain:         "athenz",
+				Service:        "example",
+			},
+		},
+		{
+			name:   "kubernetes format with a plain service account",
+			input:  "spiffe://cluster.local/ns/default/sa/api",
+			format: SpiffeURIFormatKubernetes,
+			expected: &SpiffeIdentity{
+				TrustDomain:    "cluster.local",
+				Namespace:      "default",
+				ServiceAccount: "api",
+				Domain:         "",
+				Service:        "api",
+			},
+		},
+		{
+			name:        "kubernetes format rejects the athenz service layout",
+			input:       "spiffe://athenz.prod/sa/api",
+			format:      SpiffeURIFormatKubernetes,
+			expectError: true,
+		},
+		{
+			name:   "athenz service format",
+			input:  "spiffe://athenz.prod/sa/api",
+			format: SpiffeURIFormatAthenzService,
+			expected: &SpiffeIdentity{
+				TrustDomain:    "athenz.prod",
+				Namespace:      "",
+				ServiceAccount: "athenz.prod.api",
+				Domain:         "athenz.prod",
+				Service:        "api",
+			},
+		},
+		{
+			name:        "athenz service format rejects the namespaced layout",
+			input:       "spiffe://athenz.io/ns/default/sa/athenz.prod.api",
+			format:      SpiffeURIFormatAthenzService,
+			expectError: true,
+		},
+		{
+			name:   "athenz namespace format",
+			input:  "spiffe://athenz.io/ns/default/sa/athenz.prod.api",
+			format: SpiffeURIFormatAthenzNamespace,
+			expected: &SpiffeIdentity{
+				TrustDomain:    "athenz.io",
+				Namespace:      "default",
+				ServiceAccount: "athenz.prod.api",
+				Domain:         "athenz.prod",
+				Service:        "api",
+			},
+		},
+		{
+			name:        "athenz namespace format requires a domain",
+			input:       "spiffe://athenz.io/ns/default/sa/api",
+			format:      SpiffeURIFormatAthenzNamespace,
+			expectError: true,
+		},
+		{
+			name:        "unknown format",
+			input:       "spiffe://cluster.local/ns/default/sa/athenz.example",
+			format:      "Unknown",
+			expectError: true,
+		},
+		{
+			name:        "not a spiffe uri",
+			input:       "invalid-spiffe-uri",
+			format:      SpiffeURIFormatKubernetes,
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			identity, err := ParseSpiffeURI(tc.input, tc.format)
+
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("Expected an error for input: %s", tc.input)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error for input: %s - %v", tc.input, err)
+			}
+
+			if *identity != *tc.expected {
+				t.Errorf("Expected identity %+v, but got %+v for input: %s", *tc.expected, *identity, tc.input)
+			}
+		})
+	}
+}
+
 func TestExtractSpiffeURIFromAnnotations(t *testing.T) {
 	testCases := []struct {
 		input              map[string]string
@@ -144,6 +254,151 @@ func TestExtractSpiffeURIFromAnnotations(t *testing.T) {
 	}
 }
 
+func TestExtractTrustDomainFromSpiffeURI(t *testing.T) {
+	testCases := []struct {
+		input               string
+		expectedTrustDomain string
+		expectError         bool
+	}{
+		{
+			input:               "spiffe://cluster.local/ns/default/sa/my.example",
+			expectedTrustDomain: "cluster.local",
+			expectError:         false,
+		},
+		{
+			input:               "spiffe://evil.example/ns/x/sa/y",
+			expectedTrustDomain: "evil.example",
+			expectError:         false,
+		},
+		{
+			input:               "https://cluster.local/ns/default/sa/my.example",
+			expectedTrustDomain: "",
+			expectError:         true,
+		},
+		{
+			input:               "spiffe:///ns/default/sa/my.example",
+			expectedTrustDomain: "",
+			expectError:         true,
+		},
+		{
+			input:               "spiffe://user@cluster.local/ns/default/sa/my.example",
+			expectedTrustDomain: "",
+			expectError:         true,
+		},
+	}
+
+	for _, tc := range testCases {
+		trustDomain, err := ExtractTrustDomainFromSpiffeURI(tc.input)
+
+		if tc.expectError && err == nil {
+			t.Errorf("Expected an error for input: %s", tc.input)
+		}
+
+		if !tc.expectError && err != nil {
+			t.Errorf("Unexpected error for input: %s - %v", tc.input, err)
+		}
+
+		if trustDomain != tc.expectedTrustDomain {
+			t.Errorf("Expected trust domain '%s', but got '%s' for input: %s", tc.expectedTrustDomain, trustDomain, tc.input)
+		}
+	}
+}
+
+func TestIsTrustDomainAllowed(t *testing.T) {
+	testCases := []struct {
+		trustDomain string
+		allowed     []string
+		expected    bool
+	}{
+		{trustDomain: "cluster.local", allowed: nil, expected: true},
+		{trustDomain: "cluster.local", allowed: []string{"cluster.local"}, expected: true},
+		{trustDomain: "Cluster.Local", allowed: []string{"cluster.local"}, expected: true},
+		{trustDomain: "evil.example", allowed: []string{"cluster.local"}, expected: false},
+		{trustDomain: "sub.cluster.local", allowed: []string{"cluster.local"}, expected: false},
+	}
+
+	for _, tc := range testCases {
+		if got := IsTrustDomainAllowed(tc.trustDomain, tc.allowed); got != tc.expected {
+			t.Errorf("Expected %v for trust domain '%s' and allow list %v, but got %v", tc.expected, tc.trustDomain, tc.allowed, got)
+		}
+	}
+}
+
+func TestMatchAthenzNamePatterns(t *testing.T) {
+	testCases := []struct {
+		name     string
+		patterns []string
+		expected bool
+	}{
+		{name: "corp.payments", patterns: []string{"corp.payments"}, expected: true},
+		{name: "corp.payments.api", patterns: []string{"corp.payments.*"}, expected: true},
+		{name: "corp.payments.eu.api", patterns: []string{"corp.payments.*"}, expected: true},
+		{name: "corp.payments", patterns: []string{"corp.payments.*"}, expected: false},
+		{name: "corp.paymentsx", patterns: []string{"corp.payments.*"}, expected: false},
+		{name: "corp.billing", patterns: []string{"corp.payments.*", "corp.billing"}, expected: true},
+		{name: "corp.payments", patterns: nil, expected: false},
+		{name: "corp.payments", patterns: []string{"corp.[payments"}, expected: false},
+	}
+
+	for _, tc := range testCases {
+		if got := MatchAthenzNamePatterns(tc.name, tc.patterns); got != tc.expected {
+			t.Errorf("Expected %v for name '%s' and patterns %v, but got %v", tc.expected, tc.name, tc.patterns, got)
+		}
+	}
+
+	if err := ValidateAthenzNamePatterns([]string{"corp.payments.*", "corp.[payments"}); err == nil {
+		t.Errorf("Expected an error for a malformed pattern")
+	}
+}
+
+func TestExtractWorkloadAnnotations(t *testing.T) {
+	keys := WorkloadAnnotationKeys{SpiffeURI: []string{"example.com/identity"}}.Merge(DefaultWorkloadAnnotationKeys).Merge(CSIPodInfoAnnotationKeys)
+
+	testCases := []struct {
+		input    map[string]string
+		expected WorkloadAnnotations
+	}{
+		{
+			input: map[string]string{
+				"csi.cert-manager.athenz.io/identity": "spiffe://cluster.local/ns/default/sa/athenz.api",
+			},
+			expected: WorkloadAnnotations{SpiffeURI: "spiffe://cluster.local/ns/default/sa/athenz.api"},
+		},
+		{
+			// configured keys take precedence over the defaults
+			input: map[string]string{
+				"example.com/identity":                "spiffe://cluster.local/ns/default/sa/athenz.web",
+				"csi.cert-manager.athenz.io/identity": "spiffe://cluster.local/ns/default/sa/athenz.api",
+			},
+			expected: WorkloadAnnotations{SpiffeURI: "spiffe://cluster.local/ns/default/sa/athenz.web"},
+		},
+		{
+			input: map[string]string{
+				"csi.storage.k8s.io/pod.name":            "web-0",
+				"csi.storage.k8s.io/pod.namespace":       "default",
+				"csi.storage.k8s.io/pod.uid":             "1c7d6a3e-0d3a-4a43-9a3c-3c1d6a3e0d3a",
+				"csi.storage.k8s.io/serviceAccount.name": "athenz.web",
+			},
+			expected: WorkloadAnnotations{
+				PodName:        "web-0",
+				PodNamespace:   "default",
+				PodUID:         "1c7d6a3e-0d3a-4a43-9a3c-3c1d6a3e0d3a",
+				ServiceAccount: "athenz.web",
+			},
+		},
+		{
+			input:    map[string]string{"example.com/identity": ""},
+			expected: WorkloadAnnotations{},
+		},
+	}
+
+	for _, tc := range testCases {
+		if got := ExtractWorkloadAnnotations(tc.input, keys); got != tc.expected {
+			t.Errorf("Expected %+v, but got %+v for input: %v", tc.expected, got, tc.input)
+		}
+	}
+}
+
 func TestExtractSpiffeURIFromCSR(t *testing.T) {
 	testCases := []struct {
 		input              []byte
@@ -239,4 +494,172 @@ func defaultCSRDetails() CertReqDetails {
 		Org:        "Athenz",
 		URIs: append(uris, uri),
 	}
-}
\ No newline at end of file
+}
+func TestValidateAthenzCSR(t *testing.T) {
+	mustParseURI := func(s string) *url.URL {
+		u, err := url.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	policy := AthenzSANPolicy{DNSSuffixes: []string{"athenz.cloud", ".svc.example."}}
+
+	testCases := []struct {
+		name        string
+		template    x509.Certificate
+		policy      AthenzSANPolicy
+		expectError bool
+	}{
+		{
+			name: "conforming names",
+			template: x509.Certificate{
+				Subject:  pkix.Name{CommonName: "athenz.prod.api"},
+				DNSNames: []string{"api.athenz-prod.athenz.cloud", "api.athenz-prod.svc.example"},
+				URIs: []*url.URL{
+					mustParseURI("spiffe://athenz.prod/sa/api"),
+					mustParseURI("spiffe://cluster.local/ns/prod/sa/athenz.prod.api"),
+					mustParseURI("athenz://instanceid/athenz.k8s.aws-us-east-1/4f3c"),
+				},
+			},
+			policy: policy,
+		},
+		{
+			name:        "common name of another service",
+			template:    x509.Certificate{Subject: pkix.Name{CommonName: "athenz.prod.web"}},
+			policy:      policy,
+			expectError: true,
+		},
+		{
+			name: "DNS SAN with an unknown suffix",
+			template: x509.Certificate{
+				Subject:  pkix.Name{CommonName: "athenz.prod.api"},
+				DNSNames: []string{"api.athenz-prod.example.com"},
+			},
+			policy:      policy,
+			expectError: true,
+		},
+		{
+			name: "DNS SAN without suffixes configured",
+			template: x509.Certificate{
+				Subject:  pkix.Name{CommonName: "athenz.prod.api"},
+				DNSNames: []string{"api.athenz-prod.athenz.cloud"},
+			},
+			expectError: true,
+		},
+		{
+			name: "Kubernetes SPIFFE URI",
+			template: x509.Certificate{
+				Subject: pkix.Name{CommonName: "athenz.prod.api"},
+				URIs:    []*url.URL{mustParseURI("spiffe://cluster.local/ns/prod/sa/api")},
+			},
+			policy:      policy,
+			expectError: true,
+		},
+		{
+			name: "wildcard not allowed",
+			template: x509.Certificate{
+				Subject:  pkix.Name{CommonName: "athenz.prod.api"},
+				DNSNames: []string{"*.api.athenz-prod.athenz.cloud"},
+			},
+			policy:      policy,
+			expectError: true,
+		},
+		{
+			name: "wildcard allowed",
+			template: x509.Certificate{
+				Subject:  pkix.Name{CommonName: "athenz.prod.api"},
+				DNSNames: []string{"*.api.athenz-prod.athenz.cloud"},
+			},
+			policy: AthenzSANPolicy{DNSSuffixes: []string{"athenz.cloud"}, AllowWildcards: true},
+		},
+		{
+			name: "IP SAN not allowed",
+			template: x509.Certificate{
+				Subject:     pkix.Name{CommonName: "athenz.prod.api"},
+				IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+			},
+			policy:      policy,
+			expectError: true,
+		},
+		{
+			name: "IP SAN allowed",
+			template: x509.Certificate{
+				Subject:     pkix.Name{CommonName: "athenz.prod.api"},
+				IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+			},
+			policy: AthenzSANPolicy{AllowIPAddresses: true},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateAthenzCSR(&tc.template, "athenz.prod", "api", tc.policy)
+			if tc.expectError && err == nil {
+				t.Errorf("Expected an error")
+			}
+			if !tc.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestExtractAthenzInstanceID(t *testing.T) {
+	mustParseURI := func(s string) *url.URL {
+		u, err := url.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	const provider = "athenz.k8s.aws-us-east-1"
+
+	testCases := []struct {
+		name               string
+		uris               []string
+		expectedInstanceID string
+		expectError        bool
+	}{
+		{
+			name:               "instance ID of the provider",
+			uris:               []string{"spiffe://athenz.prod/sa/api", "athenz://instanceid/athenz.k8s.aws-us-east-1/4f3c"},
+			expectedInstanceID: "4f3c",
+		},
+		{
+			name:        "instance ID of another provider",
+			uris:        []string{"athenz://instanceid/athenz.k8s.gcp-us-east1/4f3c"},
+			expectError: true,
+		},
+		{
+			name:        "malformed instance ID",
+			uris:        []string{"athenz://instanceid/athenz.k8s.aws-us-east-1/4f3c/extra"},
+			expectError: true,
+		},
+		{
+			name:        "no instance ID",
+			uris:        []string{"spiffe://athenz.prod/sa/api"},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		template := &x509.Certificate{}
+		for _, uri := range tc.uris {
+			template.URIs = append(template.URIs, mustParseURI(uri))
+		}
+		instanceID, err := ExtractAthenzInstanceID(template, provider)
+		if tc.expectError {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		}
+		if instanceID != tc.expectedInstanceID {
+			t.Errorf("%s: expected instance ID %s, but got %s", tc.name, tc.expectedInstanceID, instanceID)
+		}
+	}
+}
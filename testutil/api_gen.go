@@ -100,11 +100,13 @@ func AthenzClusterIssuer(name string, mods ...AthenzClusterIssuerModifier) *athe
 		ObjectMeta: metav1.ObjectMeta{
 			Name: name,
 		},
-		Spec: athenzissuerapi.AthenzCertificateSource{
-			ZTSEndpoint:    "https://zts.athenz.io:4443/zts/v1",
-			Cloud:          "local",
-			Region:         "local",
-			ProviderPrefix: "athenz.k8s",
+		Spec: athenzissuerapi.AthenzClusterIssuerSpec{
+			AthenzCertificateSource: athenzissuerapi.AthenzCertificateSource{
+				ZTSEndpoint:    "https://zts.athenz.io:4443/zts/v1",
+				Cloud:          "local",
+				Region:         "local",
+				ProviderPrefix: "athenz.k8s",
+			},
 		},
 	}
 	for _, mod := range mods {
@@ -16,9 +16,475 @@ limitations under the License.
 
 package v1
 
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +kubebuilder:validation:XValidation:rule="has(self.ztsEndpoint) || has(self.ztsEndpoints)",message="one of ztsEndpoint or ztsEndpoints is required"
 type AthenzCertificateSource struct {
-	ZTSEndpoint    string `json:"ztsEndpoint"`
+	// ZTSEndpoint is the URL of ZTS. It may be left empty when ZTSEndpoints
+	// is set. An endpoint of the form srv+_<service>._<proto>.<domain>[/<path>],
+	// e.g. srv+_zts._tcp.athenz.example, is looked up as a DNS SRV record
+	// every 5 minutes. Its targets are used as ZTSEndpoints ordered by
+	// priority, and by weight within a priority, with the path defaulting to
+	// /zts/v1. ServiceAccount tokens are then minted for
+	// https://<domain>/<path>.
+	// +optional
+	ZTSEndpoint string `json:"ztsEndpoint,omitempty"`
+
+	// ZTSEndpoints lists ZTS endpoints to fail over between, e.g. one per
+	// region. Requests stick to one healthy endpoint and move on to the next
+	// one when it cannot be reached, preferring endpoints with a higher
+	// weight and then those earlier in the list. ServiceAccount tokens are
+	// minted for the first endpoint, which takes precedence over ZTSEndpoint.
+	// +listType=map
+	// +listMapKey=url
+	// +optional
+	ZTSEndpoints []ZTSEndpoint `json:"ztsEndpoints,omitempty"`
+
 	Cloud          string `json:"cloud"`
 	Region         string `json:"region"`
 	ProviderPrefix string `json:"providerPrefix"`
+
+	// RequestTimeout bounds every call to ZTS, defaults to 30s.
+	// +optional
+	RequestTimeout *metav1.Duration `json:"requestTimeout,omitempty"`
+
+	// MaxConcurrentRequests caps the certificate requests this issuer has in
+	// flight with ZTS at the same time. Requests over the limit are requeued.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxConcurrentRequests *int32 `json:"maxConcurrentRequests,omitempty"`
+
+	// RequestsPerSecond caps the rate at which this issuer sends certificate
+	// requests to ZTS. Requests over the limit are requeued.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	RequestsPerSecond *int32 `json:"requestsPerSecond,omitempty"`
+
+	// Transport tunes the HTTP connections to ZTS.
+	// +optional
+	Transport *ZTSTransport `json:"transport,omitempty"`
+
+	// CredentialsSecretRef references a kubernetes.io/tls Secret with the
+	// certificate and key of an Athenz service the issuer authenticates its
+	// own ZTS calls with, the issuer check and the launch access check. When
+	// empty the provider credentials are used in InstanceRegisterToken mode.
+	// The Secret is read from the issuer namespace, or from the cluster
+	// resource namespace for an AthenzClusterIssuer.
+	// +optional
+	CredentialsSecretRef *LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+
+	// CABundle is a PEM bundle of the CA certificates the certificates issued
+	// by ZTS must chain to. When empty the chain is not verified, which is
+	// reported in the chainVerified field of the issuer status.
+	// +optional
+	CABundle []byte `json:"caBundle,omitempty"`
+
+	// AllowedTrustDomains restricts the SPIFFE trust domains this issuer
+	// accepts, e.g. "cluster.local". When empty any trust domain is accepted.
+	// +optional
+	AllowedTrustDomains []string `json:"allowedTrustDomains,omitempty"`
+
+	// SpiffeURIFormat selects the layout of the SPIFFE URIs this issuer
+	// accepts:
+	//  - Kubernetes: spiffe://<trust-domain>/ns/<namespace>/sa/<service-account> (default)
+	//  - AthenzService: spiffe://<domain>/sa/<service>, the namespace is taken from the request
+	//  - AthenzNamespace: spiffe://<trust-domain>/ns/<namespace>/sa/<domain>.<service>
+	// +kubebuilder:validation:Enum=Kubernetes;AthenzService;AthenzNamespace
+	// +optional
+	SpiffeURIFormat string `json:"spiffeURIFormat,omitempty"`
+
+	// IdentityAnnotations configures the request annotations the workload
+	// identity is read from. Defaults to csi.cert-manager.athenz.io/identity.
+	// +optional
+	IdentityAnnotations *IdentityAnnotations `json:"identityAnnotations,omitempty"`
+
+	// IstioCSR, when set, makes the issuer serve the CertificateRequests
+	// created by istio-csr for mesh workloads.
+	// +optional
+	IstioCSR *IstioCSR `json:"istioCSR,omitempty"`
+
+	// AllowedDomains restricts the Athenz domains this issuer requests
+	// certificates for. Entries are glob patterns, e.g. "corp.payments.*"
+	// matches every subdomain of corp.payments. When empty every domain is
+	// allowed.
+	// +optional
+	AllowedDomains []string `json:"allowedDomains,omitempty"`
+
+	// DeniedServices lists Athenz services, as <domain>.<service> glob
+	// patterns, this issuer refuses to request certificates for.
+	// +optional
+	DeniedServices []string `json:"deniedServices,omitempty"`
+
+	// CSRValidation, when set, rejects CSRs whose names do not follow the
+	// Athenz conventions before they are sent to ZTS.
+	// +optional
+	CSRValidation *CSRValidation `json:"csrValidation,omitempty"`
+
+	// Policy, when set, rejects requests that do not meet the security
+	// baseline of the issuer.
+	// +optional
+	Policy *CertificatePolicy `json:"policy,omitempty"`
+
+	// Attestation selects how workloads are attested to the Athenz provider,
+	// defaults to a token of the workload ServiceAccount.
+	// +optional
+	Attestation *Attestation `json:"attestation,omitempty"`
+
+	// AttestationContext, when set, adds the cluster and workload details of
+	// a request to the attestation data sent to ZTS.
+	// +optional
+	AttestationContext *AttestationContext `json:"attestationContext,omitempty"`
+
+	// LaunchAuthorization, when set, asks ZTS whether the namespace is
+	// authorized to launch the requested service before a certificate is
+	// requested for it.
+	// +optional
+	LaunchAuthorization *LaunchAuthorization `json:"launchAuthorization,omitempty"`
+
+	// RequesterAuthorization, when set, requires the user that created the
+	// request to pass a SubjectAccessReview against the target ServiceAccount
+	// before a token is minted on its behalf.
+	// +optional
+	RequesterAuthorization *RequesterAuthorization `json:"requesterAuthorization,omitempty"`
+}
+
+// ZTSEndpoint is one of the ZTS endpoints of an issuer.
+type ZTSEndpoint struct {
+	// URL of the endpoint.
+	// +kubebuilder:validation:MinLength=1
+	URL string `json:"url"`
+
+	// Weight ranks the endpoint when failing over, higher weights are
+	// preferred. Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Weight *int32 `json:"weight,omitempty"`
+}
+
+// ZTSTransport configures the pooled HTTP transport an issuer talks to ZTS
+// with. Connections are kept alive and reused across requests.
+type ZTSTransport struct {
+	// ProxyURL of the HTTP proxy to reach ZTS through. When empty the proxy
+	// is taken from the HTTPS_PROXY and NO_PROXY environment variables.
+	// +optional
+	ProxyURL string `json:"proxyURL,omitempty"`
+
+	// DisableHTTP2 restricts the connections to HTTP/1.1.
+	// +optional
+	DisableHTTP2 bool `json:"disableHTTP2,omitempty"`
+
+	// DialTimeout bounds establishing a TCP connection, defaults to 10s.
+	// +optional
+	DialTimeout *metav1.Duration `json:"dialTimeout,omitempty"`
+
+	// TLSHandshakeTimeout bounds the TLS handshake, defaults to 10s.
+	// +optional
+	TLSHandshakeTimeout *metav1.Duration `json:"tlsHandshakeTimeout,omitempty"`
+
+	// ResponseHeaderTimeout bounds the wait for the response headers once a
+	// request is written, defaults to 30s.
+	// +optional
+	ResponseHeaderTimeout *metav1.Duration `json:"responseHeaderTimeout,omitempty"`
+
+	// IdleConnTimeout is how long an idle connection is kept, defaults to
+	// 90s.
+	// +optional
+	IdleConnTimeout *metav1.Duration `json:"idleConnTimeout,omitempty"`
+
+	// MaxIdleConns caps the idle connections kept to ZTS, defaults to 16.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxIdleConns *int32 `json:"maxIdleConns,omitempty"`
+}
+
+// RequesterAuthorization describes the access the creator of a
+// CertificateRequest must have on the ServiceAccount it asks to be attested
+// as. The check is evaluated in the namespace of the ServiceAccount and
+// defaults to "create serviceaccounts/token".
+type RequesterAuthorization struct {
+	// Verb to check, defaults to "create".
+	// +optional
+	Verb string `json:"verb,omitempty"`
+
+	// Resource to check, defaults to "serviceaccounts". Leaving the resource
+	// empty also defaults the subresource to "token".
+	// +optional
+	Resource string `json:"resource,omitempty"`
+
+	// Subresource to check.
+	// +optional
+	Subresource string `json:"subresource,omitempty"`
+}
+
+// IdentityAnnotations lists the annotation keys, checked in order, that carry
+// the workload identity of a request. When no SPIFFE URI is found in the
+// annotations or the CSR, the identity is derived from the ServiceAccount and
+// pod namespace annotations.
+type IdentityAnnotations struct {
+	// Compatibility additionally recognises the annotations set by a stock
+	// cert-manager CSI driver:
+	//  - CSIDriver: cert-manager csi-driver, the identity is taken from the
+	//    pod ServiceAccount when the request carries no SPIFFE URI
+	//  - CSIDriverSPIFFE: cert-manager csi-driver-spiffe, the identity is
+	//    taken from the SPIFFE URI SAN of the CSR before any annotation
+	// +kubebuilder:validation:Enum=CSIDriver;CSIDriverSPIFFE
+	// +optional
+	Compatibility string `json:"compatibility,omitempty"`
+
+	// SpiffeURI annotation keys.
+	// +optional
+	SpiffeURI []string `json:"spiffeURI,omitempty"`
+
+	// PodName annotation keys.
+	// +optional
+	PodName []string `json:"podName,omitempty"`
+
+	// PodNamespace annotation keys.
+	// +optional
+	PodNamespace []string `json:"podNamespace,omitempty"`
+
+	// PodUID annotation keys.
+	// +optional
+	PodUID []string `json:"podUID,omitempty"`
+
+	// ServiceAccount annotation keys.
+	// +optional
+	ServiceAccount []string `json:"serviceAccount,omitempty"`
+}
+
+// IstioCSR configures how istio-csr requests are mapped to Athenz services.
+// The workload identity is read from the istio.cert-manager.io/identities
+// annotation and the issued certificate is returned with its intermediates
+// in the chain and the root in the CA field, as istio-csr expects.
+type IstioCSR struct {
+	// TrustDomain of the mesh, defaults to "cluster.local". Requests for
+	// identities of any other trust domain are rejected.
+	// +optional
+	TrustDomain string `json:"trustDomain,omitempty"`
+
+	// DomainPrefix, when set, maps a workload to the Athenz service
+	// <domainPrefix>.<namespace>.<serviceAccount>. When empty the
+	// ServiceAccount has to be named <domain>.<service>.
+	// +optional
+	DomainPrefix string `json:"domainPrefix,omitempty"`
+}
+
+// Attestation configures the attestation data sent to ZTS.
+type Attestation struct {
+	// Mode of attestation:
+	//  - ServiceAccountToken: a token of the workload ServiceAccount minted by the API server (default)
+	//  - ProviderJWT: a short-lived JWT signed by the issuer, see providerJWT
+	//  - InstanceRegisterToken: an instance register token ZTS mints for the
+	//    provider, see instanceRegisterToken
+	// +kubebuilder:validation:Enum=ServiceAccountToken;ProviderJWT;InstanceRegisterToken
+	// +optional
+	Mode string `json:"mode,omitempty"`
+
+	// ProviderJWT configures the ProviderJWT mode.
+	// +optional
+	ProviderJWT *ProviderJWT `json:"providerJWT,omitempty"`
+
+	// InstanceRegisterToken configures the InstanceRegisterToken mode.
+	// +optional
+	InstanceRegisterToken *InstanceRegisterToken `json:"instanceRegisterToken,omitempty"`
+
+	// ServiceAccountToken configures where the ServiceAccountToken mode takes
+	// the token from.
+	// +optional
+	ServiceAccountToken *ServiceAccountTokenSource `json:"serviceAccountToken,omitempty"`
+}
+
+// ServiceAccountTokenSource selects where ServiceAccount tokens come from.
+// Tokens read from a Secret or file are checked for expiry before use, a
+// stale token fails the request until it is refreshed. Tokens minted by the
+// API server can be cached per namespace, ServiceAccount and audience, see
+// cacheRefreshPercent.
+type ServiceAccountTokenSource struct {
+	// Source of the token:
+	//  - TokenRequest: minted by the API server for every request (default)
+	//  - Secret: read from a Secret in the namespace of the workload, see secretRef
+	//  - File: read from a file mounted into the controller, e.g. a projected
+	//    volume, see path. Only AthenzClusterIssuers may use this source.
+	// +kubebuilder:validation:Enum=TokenRequest;Secret;File
+	// +optional
+	Source string `json:"source,omitempty"`
+
+	// SecretRef references the Secret holding the token. The name may contain
+	// {serviceAccount}, which is replaced by the name of the ServiceAccount.
+	// The key defaults to "token".
+	// +optional
+	SecretRef *SecretKeySelector `json:"secretRef,omitempty"`
+
+	// Path of the token file. The path may contain {namespace} and
+	// {serviceAccount}, which are replaced by the namespace and name of the
+	// ServiceAccount.
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// CacheRefreshPercent, when above 0, caches the tokens minted by the API
+	// server: requests for the same ServiceAccount reuse a token until this
+	// percentage of its lifetime has passed, e.g. 50. Defaults to 0, which
+	// mints a token for every request.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	CacheRefreshPercent *int32 `json:"cacheRefreshPercent,omitempty"`
+
+	// BoundToPod binds the tokens minted by the API server to the pod named by
+	// the request, so they are invalidated with the pod. Bound tokens are
+	// never cached.
+	// +optional
+	BoundToPod bool `json:"boundToPod,omitempty"`
+}
+
+// ProviderJWT configures the JWT the issuer signs for every request. The JWT
+// names the namespace, ServiceAccount and pod of the workload and carries the
+// SHA-256 hash of the CSR public key. The public keys of all issuers are
+// published as a JWKS by the controller, see --jwks-bind-address. As every
+// key in the JWKS is trusted for every workload, only AthenzClusterIssuers
+// may use this mode.
+type ProviderJWT struct {
+	// SigningKeySecretRef references the PEM encoded EC or RSA private key the
+	// JWT is signed with. The Secret is read from the cluster resource
+	// namespace.
+	SigningKeySecretRef SecretKeySelector `json:"signingKeySecretRef"`
+
+	// Issuer is the iss claim of the JWT.
+	Issuer string `json:"issuer"`
+
+	// Audience is the aud claim of the JWT, defaults to the Athenz provider
+	// service.
+	// +optional
+	Audience string `json:"audience,omitempty"`
+
+	// Lifetime of the JWT, defaults to 5m.
+	// +optional
+	Lifetime *metav1.Duration `json:"lifetime,omitempty"`
+}
+
+// InstanceRegisterToken configures how the issuer fetches instance register
+// tokens. The issuer authenticates to ZTS as the Athenz provider and asks for
+// a token for the requested domain, service and instance ID. The instance ID
+// is taken from the athenz://instanceid/<provider>/<instance-id> URI SAN of
+// the CSR, requests without one are rejected.
+type InstanceRegisterToken struct {
+	// ProviderCredentialsSecretRef references a kubernetes.io/tls Secret with
+	// the certificate and key of the Athenz provider service. The Secret is
+	// read from the issuer namespace, or from the cluster resource namespace
+	// for an AthenzClusterIssuer.
+	ProviderCredentialsSecretRef LocalObjectReference `json:"providerCredentialsSecretRef"`
+}
+
+// LocalObjectReference references an object in the same namespace.
+type LocalObjectReference struct {
+	// Name of the object.
+	Name string `json:"name"`
+}
+
+// SecretKeySelector references a key of a Secret.
+type SecretKeySelector struct {
+	// Name of the Secret.
+	Name string `json:"name"`
+
+	// Key in the Secret, defaults to "tls.key".
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// AttestationContext configures the extra attestation data. Besides the
+// cluster name the data carries the CertificateRequest UID, and the pod name,
+// UID and node name when the request names a pod that runs as the requested
+// ServiceAccount, together with an instance ID derived from them that stays
+// stable across renewals of the same pod. Requests naming a pod of another
+// ServiceAccount are rejected.
+type AttestationContext struct {
+	// ClusterName identifies this cluster to the Athenz provider.
+	ClusterName string `json:"clusterName"`
+}
+
+// CSRValidation describes the names a CSR may request for the Athenz service
+// <domain>.<service>: the common name has to be <domain>.<service>, DNS SANs
+// <service>.<domain-with-dashes>.<suffix> and URI SANs
+// spiffe://<domain>/sa/<service>,
+// spiffe://<trust-domain>/ns/<namespace>/sa/<domain>.<service> or
+// athenz://instanceid/<provider>/<instance-id>.
+type CSRValidation struct {
+	// DNSSuffixes lists the suffixes DNS SANs may use, e.g. athenz.cloud.
+	// When empty no DNS SAN is accepted.
+	// +optional
+	DNSSuffixes []string `json:"dnsSuffixes,omitempty"`
+
+	// AllowIPAddresses accepts IP SANs.
+	// +optional
+	AllowIPAddresses bool `json:"allowIPAddresses,omitempty"`
+
+	// AllowWildcards accepts *.<service>.<domain-with-dashes>.<suffix> DNS
+	// SANs.
+	// +optional
+	AllowWildcards bool `json:"allowWildcards,omitempty"`
+}
+
+// CertificatePolicy is the security baseline requests have to meet. Requests
+// for CA certificates are always rejected, every other rule only applies
+// when it is set.
+type CertificatePolicy struct {
+	// KeyAlgorithms lists the key algorithms requests may use, with their
+	// minimum key sizes.
+	// +listType=map
+	// +listMapKey=algorithm
+	// +optional
+	KeyAlgorithms []KeyAlgorithmPolicy `json:"keyAlgorithms,omitempty"`
+
+	// AllowedUsages lists the key usages and extended key usages requests
+	// may ask for, named as in the usages of a cert-manager Certificate, e.g.
+	// "digital signature" or "client auth".
+	// +optional
+	AllowedUsages []string `json:"allowedUsages,omitempty"`
+
+	// MaxSANs caps the number of DNS, IP, URI and email SANs of a request.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxSANs *int32 `json:"maxSANs,omitempty"`
+
+	// AllowedSubjectFields lists the subject fields requests may set.
+	// +optional
+	AllowedSubjectFields []SubjectField `json:"allowedSubjectFields,omitempty"`
+}
+
+// KeyAlgorithmPolicy allows a key algorithm.
+type KeyAlgorithmPolicy struct {
+	// +kubebuilder:validation:Enum=RSA;ECDSA;Ed25519
+	Algorithm string `json:"algorithm"`
+
+	// MinSize is the minimum key size in bits, the curve size for ECDSA.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MinSize int32 `json:"minSize,omitempty"`
+}
+
+// SubjectField is a field of the subject of a certificate.
+// +kubebuilder:validation:Enum=CommonName;Organization;OrganizationalUnit;Country;Province;Locality;StreetAddress;PostalCode;SerialNumber
+type SubjectField string
+
+// LaunchAuthorization describes the ZTS access check made for every request.
+// The check asks whether the principal <principalPrefix>.<namespace> may
+// perform the action on the resource <domain>:service.<service>, letting
+// Athenz policy decide which namespaces may launch which services. ZTS only
+// answers authenticated callers, the check is made with the issuer
+// credentials, see credentialsSecretRef, or in InstanceRegisterToken mode
+// with the provider credentials.
+type LaunchAuthorization struct {
+	// PrincipalPrefix is prepended to the namespace to form the principal
+	// that is checked, e.g. "athenz.k8s.prod-cluster".
+	PrincipalPrefix string `json:"principalPrefix"`
+
+	// Action to check, defaults to "launch".
+	// +optional
+	Action string `json:"action,omitempty"`
+
+	// CacheDuration is how long a ZTS answer is reused, defaults to 30s.
+	// +optional
+	CacheDuration *metav1.Duration `json:"cacheDuration,omitempty"`
 }
@@ -38,12 +38,29 @@ type AthenzClusterIssuer struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec   AthenzCertificateSource `json:"spec,omitempty"`
-	Status v1alpha1.IssuerStatus   `json:"status,omitempty"`
+	Spec   AthenzClusterIssuerSpec `json:"spec,omitempty"`
+	Status AthenzIssuerStatus      `json:"status,omitempty"`
+}
+
+// AthenzClusterIssuerSpec is an AthenzCertificateSource that can be scoped to
+// a set of namespaces.
+type AthenzClusterIssuerSpec struct {
+	AthenzCertificateSource `json:",inline"`
+
+	// AllowedNamespaces restricts the namespaces whose ServiceAccounts this
+	// issuer attests. When empty every namespace is allowed.
+	// +optional
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+
+	// NamespaceSelector restricts the namespaces whose ServiceAccounts this
+	// issuer attests to those matching the selector. When both this and
+	// AllowedNamespaces are set a namespace has to satisfy both.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
 }
 
 func (vi *AthenzClusterIssuer) GetStatus() *v1alpha1.IssuerStatus {
-	return &vi.Status
+	return &vi.Status.IssuerStatus
 }
 
 func (vi *AthenzClusterIssuer) GetIssuerTypeIdentifier() string {
@@ -0,0 +1,82 @@
+/*
+Copyright The Athenz Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cert-manager/issuer-lib/api/v1alpha1"
+)
+
+// AthenzIssuerStatus is the status of an AthenzIssuer or
+// AthenzClusterIssuer. The conditions are managed by issuer-lib, the other
+// fields by the controller.
+type AthenzIssuerStatus struct {
+	v1alpha1.IssuerStatus `json:",inline"`
+
+	// LastReachableTime is when ZTS last answered the check of the issuer
+	// over a verified TLS connection.
+	// +optional
+	LastReachableTime *metav1.Time `json:"lastReachableTime,omitempty"`
+
+	// CheckAuthenticated reports whether that check was made with the
+	// credentials of the issuer and ZTS accepted them. Issuers without
+	// credentials make an unauthenticated call, which only shows that ZTS
+	// can be reached and its certificate verified.
+	// +optional
+	CheckAuthenticated bool `json:"checkAuthenticated,omitempty"`
+
+	// CheckLatency is how long ZTS took to answer the last successful check.
+	// +optional
+	CheckLatency *metav1.Duration `json:"checkLatency,omitempty"`
+
+	// ChainVerified reports whether the certificate chains ZTS returns are
+	// verified against the caBundle of the issuer. It is false while the
+	// issuer has no caBundle, the chains are then trusted as ZTS returns
+	// them.
+	// +optional
+	ChainVerified bool `json:"chainVerified,omitempty"`
+
+	// ZTSEndpoints reports the health of the ZTS endpoints of the issuer.
+	// +listType=map
+	// +listMapKey=url
+	// +optional
+	ZTSEndpoints []ZTSEndpointStatus `json:"ztsEndpoints,omitempty"`
+}
+
+// ZTSEndpointStatus is the health of a ZTS endpoint as seen by the last
+// probe or request.
+type ZTSEndpointStatus struct {
+	// URL of the endpoint.
+	URL string `json:"url"`
+
+	// Healthy is false while the endpoint cannot be reached.
+	Healthy bool `json:"healthy"`
+
+	// Active is true for the endpoint requests are currently sent to.
+	// +optional
+	Active bool `json:"active,omitempty"`
+
+	// LastTransitionTime is when the endpoint last became healthy or
+	// unhealthy.
+	// +optional
+	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// Message is the error that made the endpoint unhealthy.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
@@ -38,7 +38,7 @@ type AthenzIssuer struct {
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
 	Spec   AthenzCertificateSource `json:"spec,omitempty"`
-	Status v1alpha1.IssuerStatus   `json:"status,omitempty"`
+	Status AthenzIssuerStatus      `json:"status,omitempty"`
 }
 
 func (vi *AthenzIssuer) GetIssuerTypeIdentifier() string {
@@ -46,7 +46,7 @@ func (vi *AthenzIssuer) GetIssuerTypeIdentifier() string {
 }
 
 func (vi *AthenzIssuer) GetStatus() *v1alpha1.IssuerStatus {
-	return &vi.Status
+	return &vi.Status.IssuerStatus
 }
 
 var _ v1alpha1.Issuer = &AthenzIssuer{}
@@ -21,12 +21,105 @@ limitations under the License.
 package v1
 
 import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AthenzCertificateSource) DeepCopyInto(out *AthenzCertificateSource) {
 	*out = *in
+	if in.ZTSEndpoints != nil {
+		in, out := &in.ZTSEndpoints, &out.ZTSEndpoints
+		*out = make([]ZTSEndpoint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RequestTimeout != nil {
+		in, out := &in.RequestTimeout, &out.RequestTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MaxConcurrentRequests != nil {
+		in, out := &in.MaxConcurrentRequests, &out.MaxConcurrentRequests
+		*out = new(int32)
+		**out = **in
+	}
+	if in.RequestsPerSecond != nil {
+		in, out := &in.RequestsPerSecond, &out.RequestsPerSecond
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Transport != nil {
+		in, out := &in.Transport, &out.Transport
+		*out = new(ZTSTransport)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CredentialsSecretRef != nil {
+		in, out := &in.CredentialsSecretRef, &out.CredentialsSecretRef
+		*out = new(LocalObjectReference)
+		**out = **in
+	}
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedTrustDomains != nil {
+		in, out := &in.AllowedTrustDomains, &out.AllowedTrustDomains
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.IdentityAnnotations != nil {
+		in, out := &in.IdentityAnnotations, &out.IdentityAnnotations
+		*out = new(IdentityAnnotations)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.IstioCSR != nil {
+		in, out := &in.IstioCSR, &out.IstioCSR
+		*out = new(IstioCSR)
+		**out = **in
+	}
+	if in.AllowedDomains != nil {
+		in, out := &in.AllowedDomains, &out.AllowedDomains
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DeniedServices != nil {
+		in, out := &in.DeniedServices, &out.DeniedServices
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CSRValidation != nil {
+		in, out := &in.CSRValidation, &out.CSRValidation
+		*out = new(CSRValidation)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Policy != nil {
+		in, out := &in.Policy, &out.Policy
+		*out = new(CertificatePolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Attestation != nil {
+		in, out := &in.Attestation, &out.Attestation
+		*out = new(Attestation)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AttestationContext != nil {
+		in, out := &in.AttestationContext, &out.AttestationContext
+		*out = new(AttestationContext)
+		**out = **in
+	}
+	if in.LaunchAuthorization != nil {
+		in, out := &in.LaunchAuthorization, &out.LaunchAuthorization
+		*out = new(LaunchAuthorization)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RequesterAuthorization != nil {
+		in, out := &in.RequesterAuthorization, &out.RequesterAuthorization
+		*out = new(RequesterAuthorization)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AthenzCertificateSource.
@@ -44,7 +137,7 @@ func (in *AthenzClusterIssuer) DeepCopyInto(out *AthenzClusterIssuer) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -98,12 +191,38 @@ func (in *AthenzClusterIssuerList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AthenzClusterIssuerSpec) DeepCopyInto(out *AthenzClusterIssuerSpec) {
+	*out = *in
+	in.AthenzCertificateSource.DeepCopyInto(&out.AthenzCertificateSource)
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AthenzClusterIssuerSpec.
+func (in *AthenzClusterIssuerSpec) DeepCopy() *AthenzClusterIssuerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AthenzClusterIssuerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AthenzIssuer) DeepCopyInto(out *AthenzIssuer) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -156,3 +275,411 @@ func (in *AthenzIssuerList) DeepCopyObject() runtime.Object {
 	}
 	return nil
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AthenzIssuerStatus) DeepCopyInto(out *AthenzIssuerStatus) {
+	*out = *in
+	in.IssuerStatus.DeepCopyInto(&out.IssuerStatus)
+	if in.LastReachableTime != nil {
+		in, out := &in.LastReachableTime, &out.LastReachableTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CheckLatency != nil {
+		in, out := &in.CheckLatency, &out.CheckLatency
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.ZTSEndpoints != nil {
+		in, out := &in.ZTSEndpoints, &out.ZTSEndpoints
+		*out = make([]ZTSEndpointStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AthenzIssuerStatus.
+func (in *AthenzIssuerStatus) DeepCopy() *AthenzIssuerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AthenzIssuerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Attestation) DeepCopyInto(out *Attestation) {
+	*out = *in
+	if in.ProviderJWT != nil {
+		in, out := &in.ProviderJWT, &out.ProviderJWT
+		*out = new(ProviderJWT)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.InstanceRegisterToken != nil {
+		in, out := &in.InstanceRegisterToken, &out.InstanceRegisterToken
+		*out = new(InstanceRegisterToken)
+		**out = **in
+	}
+	if in.ServiceAccountToken != nil {
+		in, out := &in.ServiceAccountToken, &out.ServiceAccountToken
+		*out = new(ServiceAccountTokenSource)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Attestation.
+func (in *Attestation) DeepCopy() *Attestation {
+	if in == nil {
+		return nil
+	}
+	out := new(Attestation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AttestationContext) DeepCopyInto(out *AttestationContext) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AttestationContext.
+func (in *AttestationContext) DeepCopy() *AttestationContext {
+	if in == nil {
+		return nil
+	}
+	out := new(AttestationContext)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CSRValidation) DeepCopyInto(out *CSRValidation) {
+	*out = *in
+	if in.DNSSuffixes != nil {
+		in, out := &in.DNSSuffixes, &out.DNSSuffixes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CSRValidation.
+func (in *CSRValidation) DeepCopy() *CSRValidation {
+	if in == nil {
+		return nil
+	}
+	out := new(CSRValidation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertificatePolicy) DeepCopyInto(out *CertificatePolicy) {
+	*out = *in
+	if in.KeyAlgorithms != nil {
+		in, out := &in.KeyAlgorithms, &out.KeyAlgorithms
+		*out = make([]KeyAlgorithmPolicy, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedUsages != nil {
+		in, out := &in.AllowedUsages, &out.AllowedUsages
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaxSANs != nil {
+		in, out := &in.MaxSANs, &out.MaxSANs
+		*out = new(int32)
+		**out = **in
+	}
+	if in.AllowedSubjectFields != nil {
+		in, out := &in.AllowedSubjectFields, &out.AllowedSubjectFields
+		*out = make([]SubjectField, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertificatePolicy.
+func (in *CertificatePolicy) DeepCopy() *CertificatePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificatePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IdentityAnnotations) DeepCopyInto(out *IdentityAnnotations) {
+	*out = *in
+	if in.SpiffeURI != nil {
+		in, out := &in.SpiffeURI, &out.SpiffeURI
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PodName != nil {
+		in, out := &in.PodName, &out.PodName
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PodNamespace != nil {
+		in, out := &in.PodNamespace, &out.PodNamespace
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PodUID != nil {
+		in, out := &in.PodUID, &out.PodUID
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ServiceAccount != nil {
+		in, out := &in.ServiceAccount, &out.ServiceAccount
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IdentityAnnotations.
+func (in *IdentityAnnotations) DeepCopy() *IdentityAnnotations {
+	if in == nil {
+		return nil
+	}
+	out := new(IdentityAnnotations)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InstanceRegisterToken) DeepCopyInto(out *InstanceRegisterToken) {
+	*out = *in
+	out.ProviderCredentialsSecretRef = in.ProviderCredentialsSecretRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InstanceRegisterToken.
+func (in *InstanceRegisterToken) DeepCopy() *InstanceRegisterToken {
+	if in == nil {
+		return nil
+	}
+	out := new(InstanceRegisterToken)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IstioCSR) DeepCopyInto(out *IstioCSR) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IstioCSR.
+func (in *IstioCSR) DeepCopy() *IstioCSR {
+	if in == nil {
+		return nil
+	}
+	out := new(IstioCSR)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeyAlgorithmPolicy) DeepCopyInto(out *KeyAlgorithmPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeyAlgorithmPolicy.
+func (in *KeyAlgorithmPolicy) DeepCopy() *KeyAlgorithmPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(KeyAlgorithmPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LaunchAuthorization) DeepCopyInto(out *LaunchAuthorization) {
+	*out = *in
+	if in.CacheDuration != nil {
+		in, out := &in.CacheDuration, &out.CacheDuration
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LaunchAuthorization.
+func (in *LaunchAuthorization) DeepCopy() *LaunchAuthorization {
+	if in == nil {
+		return nil
+	}
+	out := new(LaunchAuthorization)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LocalObjectReference) DeepCopyInto(out *LocalObjectReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LocalObjectReference.
+func (in *LocalObjectReference) DeepCopy() *LocalObjectReference {
+	if in == nil {
+		return nil
+	}
+	out := new(LocalObjectReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProviderJWT) DeepCopyInto(out *ProviderJWT) {
+	*out = *in
+	out.SigningKeySecretRef = in.SigningKeySecretRef
+	if in.Lifetime != nil {
+		in, out := &in.Lifetime, &out.Lifetime
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProviderJWT.
+func (in *ProviderJWT) DeepCopy() *ProviderJWT {
+	if in == nil {
+		return nil
+	}
+	out := new(ProviderJWT)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RequesterAuthorization) DeepCopyInto(out *RequesterAuthorization) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RequesterAuthorization.
+func (in *RequesterAuthorization) DeepCopy() *RequesterAuthorization {
+	if in == nil {
+		return nil
+	}
+	out := new(RequesterAuthorization)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretKeySelector) DeepCopyInto(out *SecretKeySelector) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretKeySelector.
+func (in *SecretKeySelector) DeepCopy() *SecretKeySelector {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretKeySelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceAccountTokenSource) DeepCopyInto(out *ServiceAccountTokenSource) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(SecretKeySelector)
+		**out = **in
+	}
+	if in.CacheRefreshPercent != nil {
+		in, out := &in.CacheRefreshPercent, &out.CacheRefreshPercent
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceAccountTokenSource.
+func (in *ServiceAccountTokenSource) DeepCopy() *ServiceAccountTokenSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceAccountTokenSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ZTSEndpoint) DeepCopyInto(out *ZTSEndpoint) {
+	*out = *in
+	if in.Weight != nil {
+		in, out := &in.Weight, &out.Weight
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ZTSEndpoint.
+func (in *ZTSEndpoint) DeepCopy() *ZTSEndpoint {
+	if in == nil {
+		return nil
+	}
+	out := new(ZTSEndpoint)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ZTSEndpointStatus) DeepCopyInto(out *ZTSEndpointStatus) {
+	*out = *in
+	if in.LastTransitionTime != nil {
+		in, out := &in.LastTransitionTime, &out.LastTransitionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ZTSEndpointStatus.
+func (in *ZTSEndpointStatus) DeepCopy() *ZTSEndpointStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ZTSEndpointStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ZTSTransport) DeepCopyInto(out *ZTSTransport) {
+	*out = *in
+	if in.DialTimeout != nil {
+		in, out := &in.DialTimeout, &out.DialTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.TLSHandshakeTimeout != nil {
+		in, out := &in.TLSHandshakeTimeout, &out.TLSHandshakeTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.ResponseHeaderTimeout != nil {
+		in, out := &in.ResponseHeaderTimeout, &out.ResponseHeaderTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.IdleConnTimeout != nil {
+		in, out := &in.IdleConnTimeout, &out.IdleConnTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MaxIdleConns != nil {
+		in, out := &in.MaxIdleConns, &out.MaxIdleConns
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ZTSTransport.
+func (in *ZTSTransport) DeepCopy() *ZTSTransport {
+	if in == nil {
+		return nil
+	}
+	out := new(ZTSTransport)
+	in.DeepCopyInto(out)
+	return out
+}